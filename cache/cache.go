@@ -1,7 +1,8 @@
 /*
 This package implements a caching system for storing and managing cloud-based metric families.
-It provides a thread-safe, singleton CacheBackend which manages CloudCache objects.
-Each CloudCache can hold multiple MetricFamilyCaches, indexed by the metric family name to avoid duplication.
+It provides a thread-safe, singleton CacheBackend which manages CloudCache objects, kept in memory
+or, with the DiskCache backend, also stored in a directory to survive restarts.
+Each CloudCache can hold multiple MetricFamilyCaches, indexed by service and metric family name to avoid duplication.
 The system includes functionality to:
 - Initialize and retrieve a singleton CacheBackend
 - Add or update MetricFamily data in a CloudCache
@@ -15,7 +16,7 @@ An example for using the cloud cache functionality:
 // Set MetricFamily in CloudCache object
 newCloudCache := NewCloudCache()
 newCloudCache.SetMetricFamilyCache("mf-name-a", metricFamilyA)
-newCloudCache.SetMetricFamilyCache("mf-name-a", metricFamilyB)
+newCloudCache.SetMetricFamilyCache("mf-name-b", metricFamilyB)
 
 // Get singleton cache backend and atomically set this object in the cache, also setting the cache timestamp.
 cache := GetCache()
@@ -32,6 +33,8 @@ FlushExpiredCloudCaches(TTL)
 package cache
 
 import (
+	"context"
+	"slices"
 	"sync"
 	"time"
 
@@ -51,19 +54,30 @@ type CacheBackend interface {
 	FlushExpiredCloudCaches(ttl time.Duration)
 }
 
+// LeaderElector is implemented by the CacheBackends shared by several replicas,
+// where only the leader collects and the others serve the caches it stores.
+type LeaderElector interface {
+	// Lead acquires or renews the leadership for ttl and reports whether this replica is the leader.
+	Lead(ctx context.Context, ttl time.Duration) (bool, error)
+}
+
 // MetricFamily Cache Data
 type MetricFamilyCache struct {
 	Service string
 	MF      *dto.MetricFamily
+	// Collection time.
+	Time time.Time
 }
 
 // Cloud Cache Data
 type CloudCache struct {
 	// Latest update time.
 	Time time.Time
-	// The key of MetricFamilyCaches is metric family name
-	// to avoid duplicate MFs in the map.
+	// The key of MetricFamilyCaches is the service and the metric family name,
+	// to avoid duplicate MFs in the map while keeping the families shared by services apart.
 	MetricFamilyCaches map[string]*MetricFamilyCache
+	// Latest successful collection time, by service.
+	ServiceTimes map[string]time.Time
 }
 
 // GetCache return a singleton CacheBackend
@@ -79,6 +93,13 @@ func GetCache() CacheBackend {
 	return singleCache
 }
 
+// SetCache sets the CacheBackend returned by GetCache instead of the in-memory one.
+// It must be called before the cache is used.
+func SetCache(backend CacheBackend) {
+	once.Do(func() {})
+	singleCache = backend
+}
+
 // InMemoryCache is a in-memory store based CacheBackend implementation.
 type InMemoryCache struct {
 	mu          sync.Mutex
@@ -141,12 +162,82 @@ func NewCloudCache() CloudCache {
 	cloud := CloudCache{
 		Time:               time.Now(),
 		MetricFamilyCaches: make(map[string]*MetricFamilyCache),
+		ServiceTimes:       make(map[string]time.Time),
 	}
 
 	return cloud
 }
 
-// SetMetricFamilyCache updates the MetricFamilyCaches by associating a key, which is the metric family name.
+// SetMetricFamilyCache updates the MetricFamilyCaches by associating a key, which is the service of data
+// and the metric family name.
 func (c *CloudCache) SetMetricFamilyCache(mfName string, data MetricFamilyCache) {
-	c.MetricFamilyCaches[mfName] = &data
+	c.MetricFamilyCaches[metricFamilyKey(data.Service, mfName)] = &data
+}
+
+// metricFamilyKey returns the key of the metric family mfName of service in MetricFamilyCaches. Several services
+// export some families, e.g. openstack_metric_collect_seconds, each with its own metrics.
+func metricFamilyKey(service, mfName string) string {
+	return service + "/" + mfName
+}
+
+// hasService reports whether c has metric families of service.
+func (c *CloudCache) hasService(service string) bool {
+	for _, mfCache := range c.MetricFamilyCaches {
+		if mfCache.Service == service {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Keep adds the metric families of the given services of previous, which were not collected this time.
+func (c *CloudCache) Keep(previous CloudCache, services []string) {
+	for key, mfCache := range previous.MetricFamilyCaches {
+		if slices.Contains(services, mfCache.Service) {
+			c.MetricFamilyCaches[key] = mfCache
+		}
+	}
+
+	for service, collectedAt := range previous.ServiceTimes {
+		if slices.Contains(services, service) {
+			c.ServiceTimes[service] = collectedAt
+		}
+	}
+}
+
+// MergeStale adds the metric families of the given services of previous which are missing from c,
+// as long as they were collected within maxAge.
+func (c *CloudCache) MergeStale(previous CloudCache, services []string, maxAge time.Duration) {
+	for key, mfCache := range previous.MetricFamilyCaches {
+		if !slices.Contains(services, mfCache.Service) {
+			continue
+		}
+		if _, refreshed := c.ServiceTimes[mfCache.Service]; refreshed {
+			continue
+		}
+		if _, exists := c.MetricFamilyCaches[key]; exists {
+			continue
+		}
+
+		// Caches stored before the service times were tracked use the cloud's update time.
+		collectedAt, ok := previous.ServiceTimes[mfCache.Service]
+		if !ok {
+			collectedAt = previous.Time
+		}
+		if time.Since(collectedAt) > maxAge {
+			continue
+		}
+
+		c.MetricFamilyCaches[key] = mfCache
+	}
+
+	for service, collectedAt := range previous.ServiceTimes {
+		if !slices.Contains(services, service) {
+			continue
+		}
+		if _, refreshed := c.ServiceTimes[service]; !refreshed && time.Since(collectedAt) <= maxAge {
+			c.ServiceTimes[service] = collectedAt
+		}
+	}
 }
@@ -84,3 +84,32 @@ func TestCloudCacheSetMetricFamilyCache(t *testing.T) {
 	assert.NotZero(cloudCache.Time, "CloudCache.Time was not set")
 	assert.Len(cloudCache.MetricFamilyCaches, 1, "SetMetricFamilyCache value not set")
 }
+
+func TestCloudCacheMergeStale(t *testing.T) {
+	assert := assert.New(t)
+
+	previous := NewCloudCache()
+	previous.SetMetricFamilyCache("a_up", MetricFamilyCache{Service: "service-a"})
+	previous.SetMetricFamilyCache("b_up", MetricFamilyCache{Service: "service-b"})
+	previous.SetMetricFamilyCache("c_up", MetricFamilyCache{Service: "service-c"})
+	previous.ServiceTimes["service-a"] = time.Now()
+	previous.ServiceTimes["service-b"] = time.Now().Add(-time.Minute)
+	previous.ServiceTimes["service-c"] = time.Now().Add(-time.Hour)
+
+	cloudCache := NewCloudCache()
+	cloudCache.SetMetricFamilyCache("a_up", MetricFamilyCache{Service: "service-a"})
+	cloudCache.ServiceTimes["service-a"] = time.Now()
+
+	previous.SetMetricFamilyCache("d_up", MetricFamilyCache{Service: "service-d"})
+	previous.ServiceTimes["service-d"] = time.Now()
+
+	cloudCache.MergeStale(previous, []string{"service-a", "service-b", "service-c"}, 10*time.Minute)
+
+	assert.Same(previous.MetricFamilyCaches[metricFamilyKey("service-b", "b_up")], cloudCache.MetricFamilyCaches[metricFamilyKey("service-b", "b_up")], "stale service-b should be kept")
+	assert.NotContains(cloudCache.MetricFamilyCaches, metricFamilyKey("service-c", "c_up"), "service-c is older than the max age")
+	assert.NotSame(previous.MetricFamilyCaches[metricFamilyKey("service-a", "a_up")], cloudCache.MetricFamilyCaches[metricFamilyKey("service-a", "a_up")], "refreshed service-a should not be replaced")
+	assert.Equal(previous.ServiceTimes["service-b"], cloudCache.ServiceTimes["service-b"])
+	assert.NotContains(cloudCache.ServiceTimes, "service-c")
+	assert.NotContains(cloudCache.MetricFamilyCaches, metricFamilyKey("service-d", "d_up"), "service-d did not fail")
+	assert.NotContains(cloudCache.ServiceTimes, "service-d")
+}
@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// diskCacheExtension is the extension of the files holding the cache of a cloud.
+const diskCacheExtension = ".cache"
+
+// DiskCache is a CacheBackend keeping the caches in memory and writing every cloud's cache to a file
+// of a directory, so that the cached metrics are served again right after a restart.
+type DiskCache struct {
+	InMemoryCache
+
+	// writeMu serializes the file updates, the embedded cache has its own lock.
+	writeMu sync.Mutex
+	dir     string
+	logger  *slog.Logger
+}
+
+// serializedCloudCache is the serialized form of a CloudCache, shared by the persistent backends.
+type serializedCloudCache struct {
+	Time           time.Time
+	ServiceTimes   map[string]time.Time
+	MetricFamilies []serializedMetricFamily
+}
+
+// serializedMetricFamily is the serialized form of a MetricFamilyCache, the metric family being protobuf encoded.
+type serializedMetricFamily struct {
+	Service string
+	MF      []byte
+	Time    time.Time
+}
+
+// NewDiskCache returns a DiskCache writing to dir, loaded with the caches found in it.
+// The directory is created if missing.
+func NewDiskCache(dir string, logger *slog.Logger) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	c := &DiskCache{
+		InMemoryCache: InMemoryCache{CloudCaches: make(map[string]*CloudCache)},
+		dir:           dir,
+		logger:        logger,
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+diskCacheExtension))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		cloud, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(file), diskCacheExtension))
+		if err != nil {
+			logger.Warn("Ignoring unknown file in cache directory", "file", file)
+			continue
+		}
+
+		cloudCache, err := readCloudCache(file)
+		if err != nil {
+			// A corrupted file only loses the cache of one cloud, which is collected again.
+			logger.Warn("Failed to load cache file, ignoring it", "file", file, "error", err)
+			continue
+		}
+		c.CloudCaches[cloud] = &cloudCache
+		logger.Info("Loaded cache from disk", "cloud", cloud, "time", cloudCache.Time)
+	}
+
+	return c, nil
+}
+
+// SetCloudCache stores the CloudCache in memory and writes it to disk.
+// The CloudCache's Time attribute will be updated to now.
+func (c *DiskCache) SetCloudCache(cloud string, data CloudCache) {
+	c.InMemoryCache.SetCloudCache(cloud, data)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	// Write the stored copy, which has the updated time and is the latest one under writeMu.
+	cloudCache, exists := c.GetCloudCache(cloud)
+	if !exists {
+		return
+	}
+	if err := writeCloudCache(c.cloudFile(cloud), cloudCache); err != nil {
+		c.logger.Error("Failed to write cache to disk", "cloud", cloud, "error", err)
+	}
+}
+
+// FlushExpiredCloudCaches deletes the expired caches from memory and from disk.
+func (c *DiskCache) FlushExpiredCloudCaches(ttl time.Duration) {
+	c.InMemoryCache.FlushExpiredCloudCaches(ttl)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(c.dir, "*"+diskCacheExtension))
+	if err != nil {
+		c.logger.Error("Failed to list cache files", "error", err)
+		return
+	}
+	for _, file := range files {
+		cloud, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(file), diskCacheExtension))
+		if err != nil {
+			continue
+		}
+		if _, exists := c.GetCloudCache(cloud); exists {
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			c.logger.Error("Failed to delete expired cache file", "file", file, "error", err)
+		}
+	}
+}
+
+// cloudFile returns the path of the file holding the cache of cloud.
+func (c *DiskCache) cloudFile(cloud string) string {
+	return filepath.Join(c.dir, url.PathEscape(cloud)+diskCacheExtension)
+}
+
+// writeCloudCache writes cloudCache to file, replacing it atomically.
+func writeCloudCache(file string, cloudCache CloudCache) error {
+	data, err := marshalCloudCache(cloudCache)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
+
+// readCloudCache reads a CloudCache written by writeCloudCache.
+func readCloudCache(file string) (CloudCache, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return CloudCache{}, err
+	}
+
+	return unmarshalCloudCache(data)
+}
+
+// marshalCloudCache serializes cloudCache, the metric families being protobuf encoded.
+func marshalCloudCache(cloudCache CloudCache) ([]byte, error) {
+	data := serializedCloudCache{
+		Time:           cloudCache.Time,
+		ServiceTimes:   cloudCache.ServiceTimes,
+		MetricFamilies: make([]serializedMetricFamily, 0, len(cloudCache.MetricFamilyCaches)),
+	}
+	for _, mfCache := range cloudCache.MetricFamilyCaches {
+		mf, err := proto.Marshal(mfCache.MF)
+		if err != nil {
+			return nil, err
+		}
+		data.MetricFamilies = append(data.MetricFamilies, serializedMetricFamily{Service: mfCache.Service, MF: mf, Time: mfCache.Time})
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(data); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// unmarshalCloudCache deserializes a CloudCache serialized by marshalCloudCache.
+func unmarshalCloudCache(b []byte) (CloudCache, error) {
+	var data serializedCloudCache
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&data); err != nil {
+		return CloudCache{}, err
+	}
+
+	cloudCache := NewCloudCache()
+	cloudCache.Time = data.Time
+	for service, collectedAt := range data.ServiceTimes {
+		cloudCache.ServiceTimes[service] = collectedAt
+	}
+	for _, serializedMF := range data.MetricFamilies {
+		mf := &dto.MetricFamily{}
+		if err := proto.Unmarshal(serializedMF.MF, mf); err != nil {
+			return CloudCache{}, err
+		}
+		cloudCache.SetMetricFamilyCache(mf.GetName(), MetricFamilyCache{Service: serializedMF.Service, MF: mf, Time: serializedMF.Time})
+	}
+
+	return cloudCache, nil
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDiskCache(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	dir := t.TempDir()
+
+	diskCache, err := NewDiskCache(dir, logger)
+	require.NoError(t, err)
+
+	registry := prometheus.NewPedanticRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "openstack_nova_up", Help: "up"}, []string{"region"})
+	gauge.WithLabelValues("RegionOne").Set(1)
+	registry.MustRegister(gauge)
+	mfs, err := registry.Gather()
+	require.NoError(t, err)
+
+	cloudCache := NewCloudCache()
+	cloudCache.SetMetricFamilyCache(mfs[0].GetName(), MetricFamilyCache{Service: "compute", MF: mfs[0]})
+	cloudCache.ServiceTimes["compute"] = time.Unix(1700000000, 0)
+	diskCache.SetCloudCache("my/cloud", cloudCache)
+	assert.FileExists(t, filepath.Join(dir, "my%2Fcloud.cache"))
+
+	// A new backend on the same directory serves the stored cache.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.cache"), []byte("garbage"), 0o600))
+	loaded, err := NewDiskCache(dir, logger)
+	require.NoError(t, err)
+
+	stored, _ := diskCache.GetCloudCache("my/cloud")
+	restored, exists := loaded.GetCloudCache("my/cloud")
+	require.True(t, exists)
+	assert.True(t, stored.Time.Equal(restored.Time))
+	assert.True(t, cloudCache.ServiceTimes["compute"].Equal(restored.ServiceTimes["compute"]))
+	require.Contains(t, restored.MetricFamilyCaches, metricFamilyKey("compute", "openstack_nova_up"))
+	assert.Equal(t, "compute", restored.MetricFamilyCaches[metricFamilyKey("compute", "openstack_nova_up")].Service)
+	assert.True(t, proto.Equal(mfs[0], restored.MetricFamilyCaches[metricFamilyKey("compute", "openstack_nova_up")].MF))
+	_, exists = loaded.GetCloudCache("broken")
+	assert.False(t, exists)
+
+	// Expired caches are deleted from disk as well.
+	time.Sleep(2 * time.Nanosecond)
+	loaded.FlushExpiredCloudCaches(time.Nanosecond)
+	_, exists = loaded.GetCloudCache("my/cloud")
+	assert.False(t, exists)
+	assert.NoFileExists(t, filepath.Join(dir, "my%2Fcloud.cache"))
+}
@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricsCollector exposes how old the cached metrics of a cloud are.
+type MetricsCollector struct {
+	cloud       string
+	age         *prometheus.Desc
+	lastSuccess *prometheus.Desc
+	familyAge   *prometheus.Desc
+}
+
+// NewMetricsCollector returns a MetricsCollector for the cache of cloud.
+func NewMetricsCollector(prefix, cloud string) *MetricsCollector {
+	constLabels := prometheus.Labels{"cloud": cloud}
+
+	return &MetricsCollector{
+		cloud: cloud,
+		age: prometheus.NewDesc(
+			fmt.Sprintf("%s_exporter_cache_age_seconds", prefix),
+			"Time since the cached metrics of the cloud were last updated",
+			nil, constLabels,
+		),
+		lastSuccess: prometheus.NewDesc(
+			fmt.Sprintf("%s_exporter_cache_last_success_timestamp", prefix),
+			"Unix timestamp of the last successful collection of the service into the cache",
+			[]string{"service"}, constLabels,
+		),
+		familyAge: prometheus.NewDesc(
+			fmt.Sprintf("%s_exporter_cache_metric_family_age_seconds", prefix),
+			"Time since the cached metric family was collected",
+			[]string{"service", "family"}, constLabels,
+		),
+	}
+}
+
+func (c *MetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.age
+	ch <- c.lastSuccess
+	ch <- c.familyAge
+}
+
+func (c *MetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	cloudCache, exists := GetCache().GetCloudCache(c.cloud)
+	if !exists {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.age, prometheus.GaugeValue, time.Since(cloudCache.Time).Seconds())
+	for service, collectedAt := range cloudCache.ServiceTimes {
+		ch <- prometheus.MustNewConstMetric(c.lastSuccess, prometheus.GaugeValue, float64(collectedAt.UnixNano())/1e9, service)
+	}
+	for _, mfCache := range cloudCache.MetricFamilyCaches {
+		if mfCache.Time.IsZero() {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.familyAge, prometheus.GaugeValue, time.Since(mfCache.Time).Seconds(), mfCache.Service, mfCache.MF.GetName())
+	}
+}
+
+type collectionMetricsKey struct {
+	prefix string
+	cloud  string
+}
+
+var (
+	collectionMetrics   = make(map[collectionMetricsKey]*CollectionMetrics)
+	collectionMetricsMu sync.Mutex
+)
+
+// CollectionMetrics tracks the failures of the collections of a cloud into the cache.
+type CollectionMetrics struct {
+	failures            prometheus.Counter
+	consecutiveFailures prometheus.Gauge
+	lastFailure         prometheus.Gauge
+}
+
+// GetCollectionMetrics returns the CollectionMetrics of the given cloud, creating it on first use.
+func GetCollectionMetrics(prefix, cloud string) *CollectionMetrics {
+	collectionMetricsMu.Lock()
+	defer collectionMetricsMu.Unlock()
+
+	key := collectionMetricsKey{prefix, cloud}
+	m, ok := collectionMetrics[key]
+	if !ok {
+		m = NewCollectionMetrics(prefix, cloud)
+		collectionMetrics[key] = m
+	}
+
+	return m
+}
+
+func NewCollectionMetrics(prefix, cloud string) *CollectionMetrics {
+	constLabels := prometheus.Labels{"cloud": cloud}
+
+	return &CollectionMetrics{
+		failures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name:        fmt.Sprintf("%s_exporter_cache_collection_failures_total", prefix),
+			Help:        "Total number of failed collections of the cloud into the cache",
+			ConstLabels: constLabels,
+		}),
+		consecutiveFailures: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        fmt.Sprintf("%s_exporter_cache_collection_consecutive_failures", prefix),
+			Help:        "Number of failed collections of the cloud into the cache since the last successful one",
+			ConstLabels: constLabels,
+		}),
+		lastFailure: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        fmt.Sprintf("%s_exporter_cache_collection_last_failure_timestamp", prefix),
+			Help:        "Unix timestamp of the last failed collection of the cloud into the cache",
+			ConstLabels: constLabels,
+		}),
+	}
+}
+
+func (m *CollectionMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.failures.Describe(ch)
+	m.consecutiveFailures.Describe(ch)
+	m.lastFailure.Describe(ch)
+}
+
+func (m *CollectionMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.failures.Collect(ch)
+	m.consecutiveFailures.Collect(ch)
+	m.lastFailure.Collect(ch)
+}
+
+// Observe records the result of a collection of the cloud into the cache.
+func (m *CollectionMetrics) Observe(err error) {
+	if err == nil {
+		m.consecutiveFailures.Set(0)
+		return
+	}
+
+	m.failures.Inc()
+	m.consecutiveFailures.Inc()
+	m.lastFailure.SetToCurrentTime()
+}
@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsCollector(t *testing.T) {
+	cache := GetCache()
+	defer newSingleCache()
+
+	collector := NewMetricsCollector("openstack", "testCloud")
+	assert.Equal(t, 0, testutil.CollectAndCount(collector))
+
+	cloudCache := NewCloudCache()
+	cloudCache.ServiceTimes["compute"] = time.Unix(1700000000, 0)
+	cloudCache.ServiceTimes["network"] = time.Unix(1700000100, 0)
+	cloudCache.SetMetricFamilyCache("openstack_nova_up", MetricFamilyCache{Service: "compute", Time: time.Now()})
+	cloudCache.SetMetricFamilyCache("openstack_neutron_up", MetricFamilyCache{Service: "network"})
+	cache.SetCloudCache("testCloud", cloudCache)
+
+	assert.Equal(t, 1, testutil.CollectAndCount(collector, "openstack_exporter_cache_age_seconds"))
+	assert.Equal(t, 2, testutil.CollectAndCount(collector, "openstack_exporter_cache_last_success_timestamp"))
+	assert.Equal(t, 1, testutil.CollectAndCount(collector, "openstack_exporter_cache_metric_family_age_seconds"))
+	assert.Equal(t, 0, testutil.CollectAndCount(NewMetricsCollector("openstack", "otherCloud")))
+}
+
+func TestCollectionMetrics(t *testing.T) {
+	m := NewCollectionMetrics("openstack", "testCloud")
+
+	m.Observe(errors.New("keystone unavailable"))
+	m.Observe(errors.New("keystone unavailable"))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.failures))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.consecutiveFailures))
+	assert.NotZero(t, testutil.ToFloat64(m.lastFailure))
+
+	m.Observe(nil)
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.failures))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.consecutiveFailures))
+	assert.Equal(t, 3, testutil.CollectAndCount(m))
+	assert.Same(t, GetCollectionMetrics("openstack", "testCloud"), GetCollectionMetrics("openstack", "testCloud"))
+}
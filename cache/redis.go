@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisTimeout bounds every request to the Redis server.
+const redisTimeout = 5 * time.Second
+
+// leadScript renews the leader lease when held by the replica, or acquires it when free.
+var leadScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// RedisCache is a CacheBackend storing the caches in a Redis-protocol server shared by several replicas.
+// Only the replica holding the leader lease collects, the others serve the caches it stores.
+// The update time of each cache is stored under its own key, so that the last decoded cache of a
+// cloud is reused until it is updated instead of being read and decoded on every call.
+type RedisCache struct {
+	client    redis.UniversalClient
+	keyPrefix string
+	id        string
+	logger    *slog.Logger
+
+	mu      sync.Mutex
+	decoded map[string]CloudCache
+}
+
+// NewRedisCache returns a RedisCache storing its keys under keyPrefix. id identifies the replica in leader election.
+func NewRedisCache(client redis.UniversalClient, keyPrefix, id string, logger *slog.Logger) *RedisCache {
+	return &RedisCache{
+		client:    client,
+		keyPrefix: keyPrefix,
+		id:        id,
+		logger:    logger,
+		decoded:   make(map[string]CloudCache),
+	}
+}
+
+// GetCloudCache returns the CloudCache stored for cloud, the decoded one when it was not updated since.
+func (c *RedisCache) GetCloudCache(cloud string) (CloudCache, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	// The caches stored without their update time are read every time.
+	if updated, err := c.client.Get(ctx, c.timeKey(cloud)).Time(); err == nil {
+		c.mu.Lock()
+		cloudCache, ok := c.decoded[cloud]
+		c.mu.Unlock()
+		if ok && cloudCache.Time.Equal(updated) {
+			return cloudCache, true
+		}
+	}
+
+	data, err := c.client.Get(ctx, c.cloudKey(cloud)).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			c.logger.Error("Failed to read cache from Redis", "cloud", cloud, "error", err)
+		}
+		c.forget(cloud)
+		return CloudCache{}, false
+	}
+
+	cloudCache, err := unmarshalCloudCache(data)
+	if err != nil {
+		c.logger.Error("Failed to decode cache from Redis", "cloud", cloud, "error", err)
+		c.forget(cloud)
+		return CloudCache{}, false
+	}
+
+	c.mu.Lock()
+	c.decoded[cloud] = cloudCache
+	c.mu.Unlock()
+
+	return cloudCache, true
+}
+
+// SetCloudCache stores the CloudCache for cloud.
+// The CloudCache's Time attribute will be updated to now.
+func (c *RedisCache) SetCloudCache(cloud string, data CloudCache) {
+	data.Time = time.Now()
+	b, err := marshalCloudCache(data)
+	if err != nil {
+		c.logger.Error("Failed to encode cache", "cloud", cloud, "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	_, err = c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, c.cloudKey(cloud), b, 0)
+		pipe.Set(ctx, c.timeKey(cloud), data.Time, 0)
+		return nil
+	})
+	if err != nil {
+		c.logger.Error("Failed to write cache to Redis", "cloud", cloud, "error", err)
+	}
+}
+
+// FlushExpiredCloudCaches deletes the caches whose update time is older than the ttl.
+func (c *RedisCache) FlushExpiredCloudCaches(ttl time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	iter := c.client.Scan(ctx, 0, c.cloudKey("*"), 0).Iterator()
+	for iter.Next(ctx) {
+		cloud := strings.TrimPrefix(iter.Val(), c.cloudKey(""))
+		cloudCache, exists := c.GetCloudCache(cloud)
+		if !exists || time.Since(cloudCache.Time) <= ttl {
+			continue
+		}
+		if err := c.client.Del(ctx, iter.Val(), c.timeKey(cloud)).Err(); err != nil {
+			c.logger.Error("Failed to delete expired cache from Redis", "cloud", cloud, "error", err)
+		}
+		c.forget(cloud)
+	}
+	if err := iter.Err(); err != nil {
+		c.logger.Error("Failed to list caches in Redis", "error", err)
+	}
+}
+
+// Lead acquires or renews the leader lease for ttl and reports whether this replica holds it.
+func (c *RedisCache) Lead(ctx context.Context, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, redisTimeout)
+	defer cancel()
+
+	held, err := leadScript.Run(ctx, c.client, []string{c.keyPrefix + "leader"}, c.id, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return held == 1, nil
+}
+
+// cloudKey returns the key of the cache of cloud.
+func (c *RedisCache) cloudKey(cloud string) string {
+	return c.keyPrefix + "cloud:" + cloud
+}
+
+// timeKey returns the key of the update time of the cache of cloud.
+func (c *RedisCache) timeKey(cloud string) string {
+	return c.keyPrefix + "time:" + cloud
+}
+
+// forget drops the decoded cache of cloud.
+func (c *RedisCache) forget(cloud string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.decoded, cloud)
+}
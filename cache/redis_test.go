@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestRedisCache(t *testing.T, server *miniredis.Miniredis, id string) *RedisCache {
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return NewRedisCache(client, "test:", id, slog.New(slog.DiscardHandler))
+}
+
+func TestRedisCache(t *testing.T) {
+	server := miniredis.RunT(t)
+	leader := newTestRedisCache(t, server, "replica-a")
+	follower := newTestRedisCache(t, server, "replica-b")
+
+	_, exists := follower.GetCloudCache("testCloud")
+	assert.False(t, exists)
+
+	registry := prometheus.NewPedanticRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "openstack_nova_up", Help: "up"})
+	gauge.Set(1)
+	registry.MustRegister(gauge)
+	mfs, err := registry.Gather()
+	require.NoError(t, err)
+
+	cloudCache := NewCloudCache()
+	cloudCache.SetMetricFamilyCache(mfs[0].GetName(), MetricFamilyCache{Service: "compute", MF: mfs[0]})
+	cloudCache.ServiceTimes["compute"] = time.Now()
+	leader.SetCloudCache("testCloud", cloudCache)
+
+	// The other replica serves the cache stored by the leader.
+	shared, exists := follower.GetCloudCache("testCloud")
+	require.True(t, exists)
+	assert.Equal(t, "compute", shared.MetricFamilyCaches[metricFamilyKey("compute", "openstack_nova_up")].Service)
+	assert.True(t, proto.Equal(mfs[0], shared.MetricFamilyCaches[metricFamilyKey("compute", "openstack_nova_up")].MF))
+	assert.WithinDuration(t, time.Now(), shared.Time, time.Minute)
+
+	follower.FlushExpiredCloudCaches(time.Hour)
+	_, exists = follower.GetCloudCache("testCloud")
+	assert.True(t, exists)
+
+	time.Sleep(2 * time.Nanosecond)
+	follower.FlushExpiredCloudCaches(time.Nanosecond)
+	_, exists = leader.GetCloudCache("testCloud")
+	assert.False(t, exists)
+}
+
+func TestRedisCacheDecoded(t *testing.T) {
+	server := miniredis.RunT(t)
+	leader := newTestRedisCache(t, server, "replica-a")
+	follower := newTestRedisCache(t, server, "replica-b")
+
+	cloudCache := NewCloudCache()
+	cloudCache.SetMetricFamilyCache("openstack_nova_up", MetricFamilyCache{Service: "compute", MF: &dto.MetricFamily{Name: proto.String("openstack_nova_up")}})
+	leader.SetCloudCache("testCloud", cloudCache)
+	key := metricFamilyKey("compute", "openstack_nova_up")
+
+	// The cache is decoded once until it is updated.
+	first, exists := follower.GetCloudCache("testCloud")
+	require.True(t, exists)
+	second, _ := follower.GetCloudCache("testCloud")
+	assert.Same(t, first.MetricFamilyCaches[key], second.MetricFamilyCaches[key])
+
+	time.Sleep(time.Millisecond)
+	leader.SetCloudCache("testCloud", cloudCache)
+	third, _ := follower.GetCloudCache("testCloud")
+	assert.NotSame(t, second.MetricFamilyCaches[key], third.MetricFamilyCaches[key])
+	assert.True(t, third.Time.After(second.Time))
+
+	// A cache stored without its update time is decoded every time.
+	server.Del("test:time:testCloud")
+	fourth, exists := follower.GetCloudCache("testCloud")
+	require.True(t, exists)
+	assert.NotSame(t, third.MetricFamilyCaches[key], fourth.MetricFamilyCaches[key])
+
+	server.Del("test:cloud:testCloud")
+	_, exists = follower.GetCloudCache("testCloud")
+	assert.False(t, exists)
+}
+
+func TestRedisCacheLead(t *testing.T) {
+	server := miniredis.RunT(t)
+	a := newTestRedisCache(t, server, "replica-a")
+	b := newTestRedisCache(t, server, "replica-b")
+	ctx := context.Background()
+
+	leader, err := a.Lead(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, leader)
+
+	leader, err = b.Lead(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, leader)
+
+	// The lease is renewed by its holder.
+	server.FastForward(30 * time.Second)
+	leader, err = a.Lead(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, leader)
+
+	// Another replica takes over once the lease expires.
+	server.FastForward(2 * time.Minute)
+	leader, err = b.Lead(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, leader)
+	leader, err = a.Lead(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, leader)
+
+	server.Close()
+	_, err = a.Lead(ctx, time.Minute)
+	assert.Error(t, err)
+}
@@ -4,30 +4,64 @@ package cache
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"maps"
 	"net/http"
 	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/gophercloud/utils/v2/openstack/clientconfig"
 	"github.com/openstack-exporter/openstack-exporter/exporters"
 	"github.com/openstack-exporter/openstack-exporter/utils"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
+	"golang.org/x/sync/errgroup"
 )
 
-// CollectCache collects the MetricsFamily for required clouds and services and stores in the cache.
+// errServiceDown is the error of a service none of whose metrics could be collected.
+var errServiceDown = errors.New("no metric could be collected, the service is down")
+
+// ServiceErrors are the errors of the services which failed to be collected into the cache, by service.
+type ServiceErrors map[string]error
+
+func (e ServiceErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, service := range slices.Sorted(maps.Keys(e)) {
+		messages = append(messages, fmt.Sprintf("%s: %s", service, e[service]))
+	}
+	return "failed to collect services: " + strings.Join(messages, "; ")
+}
+
+// CollectCache collects the MetricsFamily of the services of cloud and stores them in the cache.
+// Up to concurrency services of a cloud are collected at the same time.
+// The cached metrics of keepServices, refreshed on their own schedule, are kept as they are.
+// The cached metrics of the services which failed to be collected are kept until they are older than
+// maxStaleAge, and a cloud whose services all failed keeps its cache unchanged.
+// A service whose up metric is 0 failed as well, its metrics are only cached when it has no previous ones.
+// The services which failed are returned as ServiceErrors, the cache being updated with the others.
 func CollectCache(
+	ctx context.Context,
 	enableExporterFunc func(
-		string, string, string, []string, string, bool, bool, bool, bool, string, string, *utils.LabelMappingFlag, int, func() (string, error), *slog.Logger,
+		context.Context, string, string, string, []string, string, bool, time.Duration, bool, bool, bool, string, string, *utils.LabelMappingFlag, int, func() (string, error), *slog.Logger,
 	) (*exporters.OpenStackExporter, error),
-	multiCloud bool,
-	services []string, prefix,
+	services []string,
+	keepServices []string,
+	prefix,
 	cloud string,
+	maxStaleAge time.Duration,
+	concurrency int,
 	disabledMetrics []string,
 	endpointType string,
 	collectTime bool,
+	metricTimeout time.Duration,
 	disableSlowMetrics bool,
 	disableDeprecatedMetrics bool,
 	disableCinderAgentUUID bool,
@@ -41,38 +75,32 @@ func CollectCache(
 	logger.Info("Run collect cache job")
 	cacheBackend := GetCache()
 
-	clouds := []string{}
-
-	if multiCloud {
-		cloudsConfig, err := clientconfig.LoadCloudsYAML()
-		if err != nil {
-			return err
-		}
-
-		for cloud := range cloudsConfig {
-			clouds = append(clouds, cloud)
-		}
-	}
-	if cloud != "" && !multiCloud {
-		clouds = append(clouds, cloud)
-	}
-
-	for _, cloud := range clouds {
-		lg := logger.With("cloud", cloud)
-		lg.Info("Start update cache data")
-		// Update cloud's cache once finish all exporters' collection job. so we won't mix the old
-		// and new metrics in the cache and confuse users.
-		cloudCache := NewCloudCache()
+	lg := logger.With("cloud", cloud)
+	lg.Info("Start update cache data")
+	// Update cloud's cache once finish all exporters' collection job. so we won't mix the old
+	// and new metrics in the cache and confuse users.
+	cloudCache := NewCloudCache()
 
-		for _, service := range services {
+	// The services are collected concurrently, up to concurrency at a time.
+	serviceErrors := ServiceErrors{}
+	// downServices are the metric families of the services which are down, by service.
+	downServices := map[string][]*dto.MetricFamily{}
+	var mu sync.Mutex
+	var g errgroup.Group
+	g.SetLimit(max(concurrency, 1))
+	for _, service := range services {
+		g.Go(func() error {
 			lg2 := lg.With("service", service)
 			lg2.Info("Start collect cache data")
 
-			exp, err := enableExporterFunc(service, prefix, cloud, disabledMetrics, endpointType, collectTime, disableSlowMetrics, disableDeprecatedMetrics, disableCinderAgentUUID, domainID, tenantID, novaMetadataMapping, dnsConcurrentCount, uuidGenFunc, logger)
+			exp, err := enableExporterFunc(ctx, service, prefix, cloud, disabledMetrics, endpointType, collectTime, metricTimeout, disableSlowMetrics, disableDeprecatedMetrics, disableCinderAgentUUID, domainID, tenantID, novaMetadataMapping, dnsConcurrentCount, uuidGenFunc, logger)
 			if err != nil {
 				// Log error and continue with enabling other exporters
 				lg2.Error("enabling exporter for service failed", "error", err)
-				continue
+				mu.Lock()
+				serviceErrors[service] = err
+				mu.Unlock()
+				return nil
 			}
 
 			registry := prometheus.NewPedanticRegistry()
@@ -81,7 +109,23 @@ func CollectCache(
 			metricFamilies, err := registry.Gather()
 			if err != nil {
 				lg2.Error("Create gather failed", "error", err)
-				continue
+				mu.Lock()
+				serviceErrors[service] = err
+				mu.Unlock()
+				return nil
+			}
+			collectedAt := time.Now()
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			// The exporter of a service is enabled from the pooled clients even when its API is down,
+			// so that the failure is only seen in its up metric.
+			if !serviceUp(metricFamilies, (*exp).GetName()+"_up") {
+				lg2.Error("Failed to collect any metric of the service")
+				serviceErrors[service] = errServiceDown
+				downServices[service] = metricFamilies
+				return nil
 			}
 
 			for _, mf := range metricFamilies {
@@ -90,42 +134,114 @@ func CollectCache(
 					MetricFamilyCache{
 						Service: service,
 						MF:      mf,
+						Time:    collectedAt,
 					},
 				)
 				lg2.Debug("Update cache data", "MetricsFamily", mf.Name)
 			}
 
+			cloudCache.ServiceTimes[service] = collectedAt
 			lg2.Info("Finish update cache data")
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	var err error
+	if len(serviceErrors) > 0 {
+		err = serviceErrors
+	}
+
+	if previous, ok := cacheBackend.GetCloudCache(cloud); ok {
+		if len(cloudCache.ServiceTimes) == 0 {
+			lg.Warn("No service collected, serving the previous cache data")
+			return err
 		}
+		cloudCache.Keep(previous, keepServices)
+		cloudCache.MergeStale(previous, slices.Collect(maps.Keys(serviceErrors)), maxStaleAge)
+	}
 
-		cacheBackend.SetCloudCache(cloud, cloudCache)
+	// The services which are down and have no previous metrics are reported down.
+	for service, metricFamilies := range downServices {
+		if cloudCache.hasService(service) {
+			continue
+		}
+		for _, mf := range metricFamilies {
+			cloudCache.SetMetricFamilyCache(*mf.Name, MetricFamilyCache{Service: service, MF: mf})
+		}
 	}
 
-	return nil
+	cacheBackend.SetCloudCache(cloud, cloudCache)
+
+	return err
+}
+
+// serviceUp reports whether the up metric of a service is 1 in its metric families, true when it has none.
+func serviceUp(metricFamilies []*dto.MetricFamily, upName string) bool {
+	for _, mf := range metricFamilies {
+		if mf.GetName() != upName {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			if m.GetGauge().GetValue() != 1 {
+				return false
+			}
+		}
+	}
+
+	return true
 }
 
 // BufferFromCache reads cloud's MetricsFamily data from cache and writes into a buffer.
 func BufferFromCache(cloud string, services []string, logger *slog.Logger) (bytes.Buffer, error) {
-	cacheBackend := GetCache()
 	var buf bytes.Buffer
+	for _, mf := range metricFamiliesFromCache(cloud, services, logger) {
+		if _, err := expfmt.MetricFamilyToText(&buf, mf); err != nil {
+			return buf, err
+		}
+	}
+
+	return buf, nil
+}
 
-	cloudCache, exists := cacheBackend.GetCloudCache(cloud)
+// metricFamiliesFromCache returns the cached MetricsFamily of the services of cloud, sorted by name.
+// The families of the same name of several services are merged.
+func metricFamiliesFromCache(cloud string, services []string, logger *slog.Logger) []*dto.MetricFamily {
+	cloudCache, exists := GetCache().GetCloudCache(cloud)
 	if !exists {
 		logger.Debug("Cache not exists", "cloud", cloud)
-		return buf, nil
+		return nil
 	}
 
-	for _, mfCache := range cloudCache.MetricFamilyCaches {
+	var metricFamilies []*dto.MetricFamily
+	indexes := map[string]int{}
+	for _, key := range slices.Sorted(maps.Keys(cloudCache.MetricFamilyCaches)) {
+		mfCache := cloudCache.MetricFamilyCaches[key]
 		if !slices.Contains(services, mfCache.Service) {
 			continue
 		}
 
-		if _, err := expfmt.MetricFamilyToText(&buf, mfCache.MF); err != nil {
-			return buf, err
+		mf := mfCache.MF
+		i, ok := indexes[mf.GetName()]
+		if !ok {
+			indexes[mf.GetName()] = len(metricFamilies)
+			metricFamilies = append(metricFamilies, mf)
+			continue
+		}
+		// The cached families are shared by the scrapes, so they are merged into a new one.
+		metricFamilies[i] = &dto.MetricFamily{
+			Name:   mf.Name,
+			Help:   mf.Help,
+			Type:   mf.Type,
+			Unit:   mf.Unit,
+			Metric: slices.Concat(metricFamilies[i].Metric, mf.Metric),
 		}
 	}
+	slices.SortStableFunc(metricFamilies, func(a, b *dto.MetricFamily) int {
+		return strings.Compare(a.GetName(), b.GetName())
+	})
 
-	return buf, nil
+	return metricFamilies
 }
 
 // FlushExpiredCloudCaches flush expired caches based on cloud's update time
@@ -135,28 +251,79 @@ func FlushExpiredCloudCaches(ttl time.Duration) {
 }
 
 // WriteCacheToResponse read cache and write to the connection as part of an HTTP reply.
-func WriteCacheToResponse(w http.ResponseWriter, r *http.Request, cloud string, enabledServices []string, logger *slog.Logger) error {
-	buf, err := BufferFromCache(cloud, enabledServices, logger)
-	if err != nil {
-		http.Error(w, "Failed to encode metrics", http.StatusInternalServerError)
-		return err
+// The metrics of gatherer, if not nil, are gathered live and written after the cached ones.
+// Like promhttp, the format is negotiated from the Accept header, OpenMetrics only if enableOpenMetrics
+// is set, and the response is gzipped if the client accepts it.
+func WriteCacheToResponse(w http.ResponseWriter, r *http.Request, cloud string, enabledServices []string, gatherer prometheus.Gatherer, enableOpenMetrics bool, logger *slog.Logger) error {
+	metricFamilies := metricFamiliesFromCache(cloud, enabledServices, logger)
+	if gatherer != nil {
+		liveMetricFamilies, err := gatherer.Gather()
+		if err != nil {
+			logger.Error("Gather live metrics failed", "error", err)
+		}
+		metricFamilies = append(metricFamilies, liveMetricFamilies...)
 	}
 
-	opts := promhttp.HandlerOpts{}
-
 	// Follow the way how promehttp package set up the contentType
 	var contentType expfmt.Format
-	if opts.EnableOpenMetrics {
+	if enableOpenMetrics {
 		contentType = expfmt.NegotiateIncludingOpenMetrics(r.Header)
 	} else {
 		contentType = expfmt.Negotiate(r.Header)
 	}
-	w.Header().Set("Content-Type", string(contentType))
 
-	if _, err = w.Write(buf.Bytes()); err != nil {
-		http.Error(w, "Failed to write cached metrics to response", http.StatusInternalServerError)
+	// Encode into a buffer first, so that an encoding error can still be reported with the status code.
+	var buf bytes.Buffer
+	enc := expfmt.NewEncoder(&buf, contentType)
+	for _, mf := range metricFamilies {
+		if err := enc.Encode(mf); err != nil {
+			http.Error(w, "Failed to encode metrics", http.StatusInternalServerError)
+			return err
+		}
+	}
+	// The OpenMetrics encoder writes the final "# EOF" line on close.
+	if closer, ok := enc.(expfmt.Closer); ok {
+		if err := closer.Close(); err != nil {
+			http.Error(w, "Failed to encode metrics", http.StatusInternalServerError)
+			return err
+		}
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", string(contentType))
+	header.Add("Vary", "Accept-Encoding")
+
+	var out io.Writer = w
+	if acceptsGzip(r.Header) {
+		header.Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
+	}
+
+	if _, err := out.Write(buf.Bytes()); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// acceptsGzip reports whether the Accept-Encoding header of a request allows a gzipped response.
+func acceptsGzip(header http.Header) bool {
+	for _, value := range header.Values("Accept-Encoding") {
+		for part := range strings.SplitSeq(value, ",") {
+			coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+				continue
+			}
+			if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+				if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	return false
+}
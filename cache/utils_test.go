@@ -2,28 +2,37 @@ package cache
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/openstack-exporter/openstack-exporter/exporters"
 	"github.com/openstack-exporter/openstack-exporter/utils"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
 	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func mockEnableExporter(
+	ctx context.Context,
 	service,
 	prefix,
 	cloud string,
 	disabledMetrics []string,
 	endpointType string,
 	collectTime bool,
+	metricTimeout time.Duration,
 	disableSlowMetrics bool,
 	disableDeprecatedMetrics bool,
 	disableCinderAgentUUID bool,
@@ -73,7 +82,6 @@ func TestCollectCache(t *testing.T) {
 	cache := GetCache()
 	defer newSingleCache()
 
-	multiCloud := false
 	services := []string{"service-a"}
 	prefix := "testPrefix"
 	cloud := "testCloud"
@@ -90,14 +98,18 @@ func TestCollectCache(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{}))
 
 	err := CollectCache(
+		context.Background(),
 		mockEnableExporter,
-		multiCloud,
 		services,
+		nil,
 		prefix,
 		cloud,
+		0,
+		1,
 		disabledMetrics,
 		endpointType,
 		collectTime,
+		0,
 		disableSlowMetrics,
 		disableDeprecatedMetrics,
 		disableCinderAgentUUID,
@@ -122,6 +134,196 @@ func TestCollectCache(t *testing.T) {
 	assert.NotContains(includeServices, "service-b", "service-b should not be included in the cache data")
 }
 
+func TestCollectCacheMaxStaleAge(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := GetCache()
+	defer newSingleCache()
+	logger := slog.New(slog.DiscardHandler)
+
+	failing := map[string]bool{}
+	enableExporter := func(ctx context.Context, service, prefix, cloud string, disabledMetrics []string, endpointType string, collectTime bool, metricTimeout time.Duration, disableSlowMetrics, disableDeprecatedMetrics, disableCinderAgentUUID bool, domainID, tenantID string, novaMetadataMapping *utils.LabelMappingFlag, dnsConcurrentCount int, uuidGenFunc func() (string, error), logger *slog.Logger) (*exporters.OpenStackExporter, error) {
+		if failing[service] {
+			return nil, errors.New("keystone unavailable")
+		}
+		var exporter exporters.OpenStackExporter = &mockOpenStackExporter{
+			cnt: prometheus.NewCounter(prometheus.CounterOpts{Name: service + "_c1", Help: "Help c1"}),
+			gge: prometheus.NewGauge(prometheus.GaugeOpts{Name: service + "_g1", Help: "Help g1"}),
+		}
+		return &exporter, nil
+	}
+	collect := func() CloudCache {
+		err := CollectCache(context.Background(), enableExporter, []string{"service_a", "service_b"}, nil, "testPrefix", "testCloud", time.Hour, 2,
+			nil, "public", false, 0, false, false, false, "", "", nil, 10, nil, logger)
+		if len(failing) == 0 {
+			assert.NoError(err)
+		} else {
+			var serviceErrors ServiceErrors
+			assert.ErrorAs(err, &serviceErrors)
+			assert.Len(serviceErrors, len(failing))
+		}
+		cloudCache, _ := cache.GetCloudCache("testCloud")
+		return cloudCache
+	}
+
+	first := collect()
+	assert.Len(first.MetricFamilyCaches, 4)
+
+	// service_b fails, its previous metrics are still served.
+	failing["service_b"] = true
+	second := collect()
+	assert.Len(second.MetricFamilyCaches, 4)
+	assert.Same(first.MetricFamilyCaches[metricFamilyKey("service_b", "service_b_c1")], second.MetricFamilyCaches[metricFamilyKey("service_b", "service_b_c1")])
+	assert.NotSame(first.MetricFamilyCaches[metricFamilyKey("service_a", "service_a_c1")], second.MetricFamilyCaches[metricFamilyKey("service_a", "service_a_c1")])
+	assert.Equal(first.ServiceTimes["service_b"], second.ServiceTimes["service_b"])
+	assert.True(second.ServiceTimes["service_a"].After(first.ServiceTimes["service_a"]))
+
+	// All services fail, the cache is left unchanged.
+	failing["service_a"] = true
+	third := collect()
+	assert.Equal(second.Time, third.Time)
+	assert.Len(third.MetricFamilyCaches, 4)
+}
+
+func TestCollectCacheServiceDown(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := GetCache()
+	defer newSingleCache()
+	logger := slog.New(slog.DiscardHandler)
+
+	up := 1.0
+	enableExporter := func(ctx context.Context, service, prefix, cloud string, disabledMetrics []string, endpointType string, collectTime bool, metricTimeout time.Duration, disableSlowMetrics, disableDeprecatedMetrics, disableCinderAgentUUID bool, domainID, tenantID string, novaMetadataMapping *utils.LabelMappingFlag, dnsConcurrentCount int, uuidGenFunc func() (string, error), logger *slog.Logger) (*exporters.OpenStackExporter, error) {
+		mock := &mockOpenStackExporter{
+			cnt: prometheus.NewCounter(prometheus.CounterOpts{Name: "c1", Help: "Help c1"}),
+			gge: prometheus.NewGauge(prometheus.GaugeOpts{Name: "MockOpenStackExporter_up", Help: "up"}),
+		}
+		mock.gge.Set(up)
+		var exporter exporters.OpenStackExporter = mock
+		return &exporter, nil
+	}
+	collect := func() (CloudCache, error) {
+		err := CollectCache(context.Background(), enableExporter, []string{"service_a"}, nil, "testPrefix", "testCloud", time.Hour, 1,
+			nil, "public", false, 0, false, false, false, "", "", nil, 10, nil, logger)
+		cloudCache, _ := cache.GetCloudCache("testCloud")
+		return cloudCache, err
+	}
+
+	// A service down without previous metrics is cached down.
+	up = 0
+	first, err := collect()
+	var serviceErrors ServiceErrors
+	assert.ErrorAs(err, &serviceErrors)
+	assert.Equal(errServiceDown, serviceErrors["service_a"])
+	assert.Len(first.MetricFamilyCaches, 2)
+	assert.NotContains(first.ServiceTimes, "service_a")
+
+	up = 1
+	second, err := collect()
+	assert.NoError(err)
+	assert.Contains(second.ServiceTimes, "service_a")
+
+	// A service going down keeps its previous metrics.
+	up = 0
+	third, err := collect()
+	assert.ErrorAs(err, &serviceErrors)
+	assert.Contains(serviceErrors, "service_a")
+	assert.Same(second.MetricFamilyCaches[metricFamilyKey("service_a", "MockOpenStackExporter_up")], third.MetricFamilyCaches[metricFamilyKey("service_a", "MockOpenStackExporter_up")])
+	assert.Equal(second.ServiceTimes["service_a"], third.ServiceTimes["service_a"])
+}
+
+func TestServiceErrors(t *testing.T) {
+	err := ServiceErrors{
+		"network": errors.New("timeout"),
+		"compute": errors.New("unauthorized"),
+	}
+	assert.EqualError(t, err, "failed to collect services: compute: unauthorized; network: timeout")
+}
+
+func TestCollectCacheKeepServices(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := GetCache()
+	defer newSingleCache()
+	logger := slog.New(slog.DiscardHandler)
+
+	enableExporter := func(ctx context.Context, service, prefix, cloud string, disabledMetrics []string, endpointType string, collectTime bool, metricTimeout time.Duration, disableSlowMetrics, disableDeprecatedMetrics, disableCinderAgentUUID bool, domainID, tenantID string, novaMetadataMapping *utils.LabelMappingFlag, dnsConcurrentCount int, uuidGenFunc func() (string, error), logger *slog.Logger) (*exporters.OpenStackExporter, error) {
+		var exporter exporters.OpenStackExporter = &mockOpenStackExporter{
+			cnt: prometheus.NewCounter(prometheus.CounterOpts{Name: service + "_c1", Help: "Help c1"}),
+			gge: prometheus.NewGauge(prometheus.GaugeOpts{Name: service + "_g1", Help: "Help g1"}),
+		}
+		return &exporter, nil
+	}
+	collect := func(services, keepServices []string) CloudCache {
+		err := CollectCache(context.Background(), enableExporter, services, keepServices, "testPrefix", "testCloud", 0, 2,
+			nil, "public", false, 0, false, false, false, "", "", nil, 10, nil, logger)
+		assert.NoError(err)
+		cloudCache, _ := cache.GetCloudCache("testCloud")
+		return cloudCache
+	}
+
+	first := collect([]string{"service_a", "service_b", "service_c"}, nil)
+	assert.Len(first.MetricFamilyCaches, 6)
+	assert.False(first.MetricFamilyCaches[metricFamilyKey("service_a", "service_a_c1")].Time.IsZero())
+
+	// service_b is refreshed on its own schedule, service_c is no longer enabled.
+	second := collect([]string{"service_a"}, []string{"service_b"})
+	assert.Len(second.MetricFamilyCaches, 4)
+	assert.Same(first.MetricFamilyCaches[metricFamilyKey("service_b", "service_b_c1")], second.MetricFamilyCaches[metricFamilyKey("service_b", "service_b_c1")])
+	assert.NotSame(first.MetricFamilyCaches[metricFamilyKey("service_a", "service_a_c1")], second.MetricFamilyCaches[metricFamilyKey("service_a", "service_a_c1")])
+	assert.Equal(first.ServiceTimes["service_b"], second.ServiceTimes["service_b"])
+	assert.NotContains(second.ServiceTimes, "service_c")
+}
+
+func TestCollectCacheSharedMetricFamily(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := GetCache()
+	defer newSingleCache()
+	logger := slog.New(slog.DiscardHandler)
+
+	failing := false
+	value := 1.0
+	enableExporter := func(ctx context.Context, service, prefix, cloud string, disabledMetrics []string, endpointType string, collectTime bool, metricTimeout time.Duration, disableSlowMetrics, disableDeprecatedMetrics, disableCinderAgentUUID bool, domainID, tenantID string, novaMetadataMapping *utils.LabelMappingFlag, dnsConcurrentCount int, uuidGenFunc func() (string, error), logger *slog.Logger) (*exporters.OpenStackExporter, error) {
+		if failing && service == "service_b" {
+			return nil, errors.New("keystone unavailable")
+		}
+		// Like openstack_metric_collect_seconds, the family is exported by every service with its own labels.
+		mock := &mockOpenStackExporter{
+			cnt: prometheus.NewCounter(prometheus.CounterOpts{Name: service + "_c1", Help: "Help c1"}),
+			gge: prometheus.NewGauge(prometheus.GaugeOpts{Name: "collect_seconds", Help: "Help collect_seconds", ConstLabels: prometheus.Labels{"service": service}}),
+		}
+		mock.gge.Set(value)
+		var exporter exporters.OpenStackExporter = mock
+		return &exporter, nil
+	}
+	collect := func() CloudCache {
+		_ = CollectCache(context.Background(), enableExporter, []string{"service_a", "service_b"}, nil, "testPrefix", "testCloud", time.Hour, 2,
+			nil, "public", false, 0, false, false, false, "", "", nil, 10, nil, logger)
+		cloudCache, _ := cache.GetCloudCache("testCloud")
+		return cloudCache
+	}
+
+	first := collect()
+	assert.Len(first.MetricFamilyCaches, 4)
+
+	// service_b fails, its metrics of the shared family are kept along with the new ones of service_a.
+	failing, value = true, 2
+	second := collect()
+	assert.Len(second.MetricFamilyCaches, 4)
+	assert.Same(first.MetricFamilyCaches[metricFamilyKey("service_b", "collect_seconds")], second.MetricFamilyCaches[metricFamilyKey("service_b", "collect_seconds")])
+
+	buf, err := BufferFromCache("testCloud", []string{"service_a", "service_b"}, logger)
+	require.NoError(t, err)
+	expected := `# HELP collect_seconds Help collect_seconds
+# TYPE collect_seconds gauge
+collect_seconds{service="service_a"} 2
+collect_seconds{service="service_b"} 1
+`
+	assert.Contains(buf.String(), expected)
+	assert.Equal(1, strings.Count(buf.String(), "# TYPE collect_seconds"))
+}
+
 func TestBufferFromCache(t *testing.T) {
 	assert := assert.New(t)
 
@@ -194,7 +396,7 @@ func TestWriteCacheToResponse(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 	handlerFunc := func(w http.ResponseWriter, r *http.Request) {
-		err := WriteCacheToResponse(w, r, cloudName, []string{serviceName}, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})))
+		err := WriteCacheToResponse(w, r, cloudName, []string{serviceName}, nil, false, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{})))
 		assert.NoError(err, "WriteCacheToResponse failed")
 	}
 	handler := http.HandlerFunc(handlerFunc)
@@ -216,6 +418,94 @@ func TestWriteCacheToResponse(t *testing.T) {
 	}
 }
 
+func TestWriteCacheToResponseWithGatherer(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := GetCache()
+	defer newSingleCache()
+	cloudName := "testCloud"
+	serviceName := "testService"
+
+	cached := prometheus.NewGauge(prometheus.GaugeOpts{Name: "cached", Help: "Help cached"})
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(cached)
+	mfs, _ := registry.Gather()
+	cloudCache := NewCloudCache()
+	cloudCache.SetMetricFamilyCache(*mfs[0].Name, MetricFamilyCache{MF: mfs[0], Service: serviceName})
+	cache.SetCloudCache(cloudName, cloudCache)
+
+	live := prometheus.NewRegistry()
+	live.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "live", Help: "Help live"}))
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	err := WriteCacheToResponse(rr, r, cloudName, []string{serviceName}, live, false, slog.New(slog.DiscardHandler))
+	assert.NoError(err, "WriteCacheToResponse failed")
+
+	parser := expfmt.NewTextParser(model.UTF8Validation)
+	metricFamilies, err := parser.TextToMetricFamilies(rr.Body)
+	assert.NoError(err)
+	assert.Contains(metricFamilies, "cached")
+	assert.Contains(metricFamilies, "live")
+}
+
+func TestWriteCacheToResponseFormats(t *testing.T) {
+	cache := GetCache()
+	defer newSingleCache()
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "cached", Help: "Help cached"}))
+	mfs, _ := registry.Gather()
+	cloudCache := NewCloudCache()
+	cloudCache.SetMetricFamilyCache(*mfs[0].Name, MetricFamilyCache{MF: mfs[0], Service: "testService"})
+	cache.SetCloudCache("testCloud", cloudCache)
+
+	write := func(accept, acceptEncoding string, enableOpenMetrics bool) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", accept)
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+		err := WriteCacheToResponse(rr, r, "testCloud", []string{"testService"}, nil, enableOpenMetrics, slog.New(slog.DiscardHandler))
+		require.NoError(t, err)
+		return rr
+	}
+	openMetrics := "application/openmetrics-text;version=1.0.0"
+
+	t.Run("OpenMetrics", func(t *testing.T) {
+		rr := write(openMetrics, "", true)
+		assert.Equal(t, expfmt.TypeOpenMetrics, expfmt.Format(rr.Header().Get("Content-Type")).FormatType())
+		assert.True(t, strings.HasSuffix(rr.Body.String(), "# EOF\n"))
+	})
+
+	t.Run("OpenMetrics disabled", func(t *testing.T) {
+		rr := write(openMetrics, "", false)
+		assert.Equal(t, expfmt.TypeTextPlain, expfmt.Format(rr.Header().Get("Content-Type")).FormatType())
+		assert.NotContains(t, rr.Body.String(), "# EOF")
+	})
+
+	t.Run("Protobuf", func(t *testing.T) {
+		rr := write("application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited", "", false)
+		format := expfmt.Format(rr.Header().Get("Content-Type"))
+		assert.Equal(t, expfmt.TypeProtoDelim, format.FormatType())
+
+		mf := &dto.MetricFamily{}
+		require.NoError(t, expfmt.NewDecoder(rr.Body, format).Decode(mf))
+		assert.Equal(t, "cached", mf.GetName())
+	})
+
+	t.Run("Gzip", func(t *testing.T) {
+		rr := write("", "gzip, deflate", false)
+		assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+		gz, err := gzip.NewReader(rr.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "cached 0")
+
+		assert.Empty(t, write("", "gzip;q=0", false).Header().Get("Content-Encoding"))
+	})
+}
+
 // TestFlushExpiredCloudCaches tests flushing of expired cloud caches.
 func TestFlushExpiredCloudCaches(t *testing.T) {
 	assert := assert.New(t)
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/openstack-exporter/openstack-exporter/cache"
+)
+
+// cacheInfo is the content of the cache listed by /-/cache.
+type cacheInfo struct {
+	Clouds []cloudCacheInfo `json:"clouds"`
+}
+
+type cloudCacheInfo struct {
+	Cloud string `json:"cloud"`
+	// Time is when the cache was last updated, unset when the cloud has no cache.
+	Time           *time.Time         `json:"time,omitempty"`
+	Services       []serviceCacheInfo `json:"services"`
+	MetricFamilies []metricFamilyInfo `json:"metric_families"`
+}
+
+type serviceCacheInfo struct {
+	Name        string        `json:"name"`
+	CollectedAt *time.Time    `json:"collected_at,omitempty"`
+	LastError   *serviceError `json:"last_error,omitempty"`
+}
+
+type metricFamilyInfo struct {
+	Name        string     `json:"name"`
+	Service     string     `json:"service"`
+	Series      int        `json:"series"`
+	CollectedAt *time.Time `json:"collected_at,omitempty"`
+}
+
+// cacheInfoHandler lists the content of the cache of every cloud, or of the cloud parameter, as JSON.
+// The last errors are the ones of the collections of this replica.
+func cacheInfoHandler(logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clouds, err := configuredClouds()
+		if err != nil {
+			logger.Error("Failed to load clouds.yaml", "error", err)
+			http.Error(w, fmt.Sprintf("failed to load clouds.yaml: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		if cloud := r.URL.Query().Get("cloud"); cloud != "" {
+			if !slices.Contains(clouds, cloud) {
+				http.Error(w, fmt.Sprintf("unknown cloud %q", cloud), http.StatusNotFound)
+				return
+			}
+			clouds = []string{cloud}
+		}
+
+		info := cacheInfo{Clouds: make([]cloudCacheInfo, 0, len(clouds))}
+		for _, cloud := range clouds {
+			info.Clouds = append(info.Clouds, cloudInfo(cloud))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(info); err != nil {
+			logger.Error("Failed to encode cache info", "error", err)
+		}
+	}
+}
+
+// cloudInfo returns the content of the cache of cloud.
+func cloudInfo(cloud string) cloudCacheInfo {
+	info := cloudCacheInfo{
+		Cloud:          cloud,
+		Services:       []serviceCacheInfo{},
+		MetricFamilies: []metricFamilyInfo{},
+	}
+
+	lastErrors := collectSchedule.lastErrors(cloud)
+	services := slices.Collect(maps.Keys(lastErrors))
+
+	cloudCache, exists := cache.GetCache().GetCloudCache(cloud)
+	if exists {
+		info.Time = &cloudCache.Time
+		services = append(services, slices.Collect(maps.Keys(cloudCache.ServiceTimes))...)
+		for _, key := range slices.Sorted(maps.Keys(cloudCache.MetricFamilyCaches)) {
+			mfCache := cloudCache.MetricFamilyCaches[key]
+			mfInfo := metricFamilyInfo{Name: mfCache.MF.GetName(), Service: mfCache.Service, Series: len(mfCache.MF.GetMetric())}
+			if !mfCache.Time.IsZero() {
+				mfInfo.CollectedAt = &mfCache.Time
+			}
+			info.MetricFamilies = append(info.MetricFamilies, mfInfo)
+			services = append(services, mfCache.Service)
+		}
+	}
+
+	slices.Sort(services)
+	for _, service := range slices.Compact(services) {
+		serviceInfo := serviceCacheInfo{Name: service}
+		if collectedAt, ok := cloudCache.ServiceTimes[service]; ok {
+			serviceInfo.CollectedAt = &collectedAt
+		}
+		if lastError, ok := lastErrors[service]; ok {
+			serviceInfo.LastError = &lastError
+		}
+		info.Services = append(info.Services, serviceInfo)
+	}
+
+	return info
+}
+
+// cacheRefreshHandler collects the cloud parameter into the cache on POST requests, only its service
+// parameter when set, and waits for the collection to finish. With a shared cache backend,
+// only the leader replica collects.
+func cacheRefreshHandler(logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "Only POST requests allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		clouds, err := configuredClouds()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to load clouds.yaml: %s", err), http.StatusInternalServerError)
+			return
+		}
+		cloudName := r.URL.Query().Get("cloud")
+		if cloudName == "" && !*multiCloud {
+			cloudName = *cloud
+		}
+		if !slices.Contains(clouds, cloudName) {
+			http.Error(w, fmt.Sprintf("unknown cloud %q", cloudName), http.StatusNotFound)
+			return
+		}
+
+		services := servicesForCloud(r.Context(), cloudName, configuredServices(), logger)
+		if service := r.URL.Query().Get("service"); service != "" {
+			if !slices.Contains(services, service) {
+				http.Error(w, fmt.Sprintf("service %q is not enabled for cloud %q", service, cloudName), http.StatusBadRequest)
+				return
+			}
+			services = []string{service}
+		}
+
+		leader, err := leadCache(r.Context())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("leader election failed: %s", err), http.StatusInternalServerError)
+			return
+		}
+		if !leader {
+			http.Error(w, "another replica is the leader, refresh the cache there", http.StatusConflict)
+			return
+		}
+
+		if !collectSchedule.start(cloudName) {
+			http.Error(w, fmt.Sprintf("a collection of cloud %q is already running", cloudName), http.StatusConflict)
+			return
+		}
+		defer collectSchedule.finish(cloudName)
+
+		logger.Info("Refreshing the cache on request", "cloud", cloudName, "services", services)
+		ctx, cancel := context.WithCancelCause(r.Context())
+		defer cancel(nil)
+		go keepLeading(ctx, cancel, logger)
+		err = collectCloudCache(ctx, cloudName, configuredServices(), services, cacheTick(), logger)
+		cache.GetCollectionMetrics(*prefix, cloudName).Observe(err)
+		if err != nil {
+			logger.Error("Failed to refresh the cache", "cloud", cloudName, "error", err)
+			http.Error(w, fmt.Sprintf("failed to refresh the cache: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		fmt.Fprintf(w, "Cache of cloud %s refreshed.\n", cloudName)
+	}
+}
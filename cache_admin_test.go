@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openstack-exporter/openstack-exporter/cache"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func setupCacheAdminTest(t *testing.T) {
+	previousCloud, previousMultiCloud, previousSchedule, previousServices := *cloud, *multiCloud, collectSchedule, enabledServices.Load()
+	*cloud, *multiCloud = "test.cloud", false
+	collectSchedule = newCacheSchedule(1)
+	enabledServices.Store(&[]string{"compute", "network"})
+	t.Cleanup(func() {
+		*cloud, *multiCloud, collectSchedule = previousCloud, previousMultiCloud, previousSchedule
+		enabledServices.Store(previousServices)
+		cache.SetCache(&cache.InMemoryCache{CloudCaches: make(map[string]*cache.CloudCache)})
+	})
+	cache.SetCache(&cache.InMemoryCache{CloudCaches: make(map[string]*cache.CloudCache)})
+}
+
+func TestCacheInfoHandler(t *testing.T) {
+	setupCacheAdminTest(t)
+	logger := slog.New(slog.DiscardHandler)
+
+	collectedAt := time.Unix(1700000000, 0).UTC()
+	cloudCache := cache.NewCloudCache()
+	cloudCache.ServiceTimes["compute"] = collectedAt
+	cloudCache.SetMetricFamilyCache("openstack_nova_up", cache.MetricFamilyCache{
+		Service: "compute",
+		MF:      &dto.MetricFamily{Name: proto.String("openstack_nova_up"), Metric: []*dto.Metric{{}, {}}},
+		Time:    collectedAt,
+	})
+	cache.GetCache().SetCloudCache("test.cloud", cloudCache)
+	collectSchedule.failed("test.cloud", cache.ServiceErrors{"network": errors.New("timeout")}, collectedAt)
+
+	rr := httptest.NewRecorder()
+	cacheInfoHandler(logger)(rr, httptest.NewRequest(http.MethodGet, "/-/cache", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var info cacheInfo
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &info))
+	require.Len(t, info.Clouds, 1)
+	cloudInfo := info.Clouds[0]
+	assert.Equal(t, "test.cloud", cloudInfo.Cloud)
+	assert.NotNil(t, cloudInfo.Time)
+	assert.Equal(t, []metricFamilyInfo{{Name: "openstack_nova_up", Service: "compute", Series: 2, CollectedAt: &collectedAt}}, cloudInfo.MetricFamilies)
+	assert.Equal(t, []serviceCacheInfo{
+		{Name: "compute", CollectedAt: &collectedAt},
+		{Name: "network", LastError: &serviceError{Error: "timeout", Time: collectedAt}},
+	}, cloudInfo.Services)
+
+	rr = httptest.NewRecorder()
+	cacheInfoHandler(logger)(rr, httptest.NewRequest(http.MethodGet, "/-/cache?cloud=unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestCacheRefreshHandler(t *testing.T) {
+	setupCacheAdminTest(t)
+	logger := slog.New(slog.DiscardHandler)
+
+	refresh := func(method, target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		cacheRefreshHandler(logger)(rr, httptest.NewRequest(method, target, nil))
+		return rr
+	}
+
+	assert.Equal(t, http.StatusMethodNotAllowed, refresh(http.MethodGet, "/-/cache/refresh").Code)
+	assert.Equal(t, http.StatusNotFound, refresh(http.MethodPost, "/-/cache/refresh?cloud=unknown").Code)
+	assert.Equal(t, http.StatusBadRequest, refresh(http.MethodPost, "/-/cache/refresh?service=dns").Code)
+
+	require.True(t, collectSchedule.start("test.cloud"))
+	assert.Equal(t, http.StatusConflict, refresh(http.MethodPost, "/-/cache/refresh?service=compute").Code)
+	collectSchedule.finish("test.cloud")
+
+	cache.SetCache(follower{&cache.InMemoryCache{CloudCaches: make(map[string]*cache.CloudCache)}})
+	rr := refresh(http.MethodPost, "/-/cache/refresh?service=compute")
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Contains(t, rr.Body.String(), "another replica is the leader")
+}
+
+// follower is a shared cache backend whose leadership is held by another replica.
+type follower struct {
+	*cache.InMemoryCache
+}
+
+func (follower) Lead(context.Context, time.Duration) (bool, error) {
+	return false, nil
+}
+
+// leaseElector is a shared cache backend counting the renewals of the leadership.
+type leaseElector struct {
+	*cache.InMemoryCache
+	leader   atomic.Bool
+	renewals atomic.Int32
+}
+
+func (e *leaseElector) Lead(context.Context, time.Duration) (bool, error) {
+	e.renewals.Add(1)
+	return e.leader.Load(), nil
+}
+
+func TestKeepLeading(t *testing.T) {
+	setupCacheAdminTest(t)
+	logger := slog.New(slog.DiscardHandler)
+	previousTTL := *cacheTTL
+	*cacheTTL = 30 * time.Millisecond
+	t.Cleanup(func() { *cacheTTL = previousTTL })
+
+	elector := &leaseElector{InMemoryCache: &cache.InMemoryCache{CloudCaches: make(map[string]*cache.CloudCache)}}
+	elector.leader.Store(true)
+	cache.SetCache(elector)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	go keepLeading(ctx, cancel, logger)
+
+	// The leadership is renewed during a collection longer than the TTL.
+	require.Eventually(t, func() bool { return elector.renewals.Load() >= 4 }, time.Second, time.Millisecond)
+	assert.NoError(t, ctx.Err())
+
+	elector.leader.Store(false)
+	<-ctx.Done()
+	assert.ErrorIs(t, context.Cause(ctx), errLeadershipLost)
+}
@@ -0,0 +1,166 @@
+// Package config loads the exporter settings from the file given with --config.file.
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/openstack-exporter/openstack-exporter/exporters"
+	"github.com/openstack-exporter/openstack-exporter/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Settings are the exporter settings which can be set for all clouds and overridden per cloud.
+// Unset fields keep the value of the command line flags.
+type Settings struct {
+	Services                 []string                `yaml:"services,omitempty"`
+	DisabledMetrics          []string                `yaml:"disabled_metrics,omitempty"`
+	DisableSlowMetrics       *bool                   `yaml:"disable_slow_metrics,omitempty"`
+	DisableDeprecatedMetrics *bool                   `yaml:"disable_deprecated_metrics,omitempty"`
+	DisableCinderAgentUUID   *bool                   `yaml:"disable_cinder_agent_uuid,omitempty"`
+	DomainID                 *string                 `yaml:"domain_id,omitempty"`
+	ProjectID                *string                 `yaml:"project_id,omitempty"`
+	NovaMetadataMapping      *utils.LabelMappingFlag `yaml:"nova_metadata_extra_labels,omitempty"`
+	// ServicesConcurrency is the number of services collected at the same time in cache mode.
+	ServicesConcurrency *int `yaml:"services_concurrency,omitempty"`
+	// RefreshIntervals sets how often services are collected in cache mode, by service.
+	RefreshIntervals map[string]time.Duration `yaml:"refresh_intervals,omitempty"`
+}
+
+// Config is the content of the configuration file.
+type Config struct {
+	Settings `yaml:",inline"`
+
+	CacheTTL *time.Duration `yaml:"cache_ttl,omitempty"`
+
+	// Clouds overrides the settings for the clouds of clouds.yaml, by name.
+	Clouds map[string]Settings `yaml:"clouds,omitempty"`
+}
+
+// Load reads and validates the configuration file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// Parse parses and validates the content of a configuration file.
+func Parse(data []byte) (*Config, error) {
+	config := &Config{}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if err := config.Settings.validate(); err != nil {
+		return nil, err
+	}
+	for cloud, settings := range config.Clouds {
+		if err := settings.validate(); err != nil {
+			return nil, fmt.Errorf("cloud %s: %w", cloud, err)
+		}
+	}
+
+	if config.CacheTTL != nil && *config.CacheTTL <= 0 {
+		return nil, fmt.Errorf("invalid cache_ttl: %s", *config.CacheTTL)
+	}
+
+	return config, nil
+}
+
+// ForCloud returns the settings of the file for cloud, the settings of the cloud
+// replacing the ones set for all clouds.
+func (c *Config) ForCloud(cloud string) Settings {
+	if c == nil {
+		return Settings{}
+	}
+
+	return c.Settings.Merge(c.Clouds[cloud])
+}
+
+// Merge returns s with the fields set in override replacing its own.
+// Lists are replaced as a whole, not merged, the refresh intervals are merged by service.
+func (s Settings) Merge(override Settings) Settings {
+	if override.Services != nil {
+		s.Services = override.Services
+	}
+	if override.DisabledMetrics != nil {
+		s.DisabledMetrics = override.DisabledMetrics
+	}
+	if override.DisableSlowMetrics != nil {
+		s.DisableSlowMetrics = override.DisableSlowMetrics
+	}
+	if override.DisableDeprecatedMetrics != nil {
+		s.DisableDeprecatedMetrics = override.DisableDeprecatedMetrics
+	}
+	if override.DisableCinderAgentUUID != nil {
+		s.DisableCinderAgentUUID = override.DisableCinderAgentUUID
+	}
+	if override.DomainID != nil {
+		s.DomainID = override.DomainID
+	}
+	if override.ProjectID != nil {
+		s.ProjectID = override.ProjectID
+	}
+	if override.NovaMetadataMapping != nil {
+		s.NovaMetadataMapping = override.NovaMetadataMapping
+	}
+	if override.ServicesConcurrency != nil {
+		s.ServicesConcurrency = override.ServicesConcurrency
+	}
+	if override.RefreshIntervals != nil {
+		s.RefreshIntervals = maps.Clone(s.RefreshIntervals)
+		if s.RefreshIntervals == nil {
+			s.RefreshIntervals = make(map[string]time.Duration, len(override.RefreshIntervals))
+		}
+		maps.Copy(s.RefreshIntervals, override.RefreshIntervals)
+	}
+
+	return s
+}
+
+func (s Settings) validate() error {
+	invalid := []string{}
+	for _, service := range s.Services {
+		if !exporters.IsExporterNameValid(service) {
+			invalid = append(invalid, service)
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("invalid services: %s", strings.Join(invalid, ","))
+	}
+
+	if s.ServicesConcurrency != nil && *s.ServicesConcurrency <= 0 {
+		return fmt.Errorf("invalid services_concurrency: %d", *s.ServicesConcurrency)
+	}
+
+	for service, interval := range s.RefreshIntervals {
+		if !exporters.IsExporterNameValid(service) {
+			return fmt.Errorf("invalid refresh interval service: %s", service)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("invalid refresh interval for %s: %s", service, interval)
+		}
+	}
+
+	// Disabled metrics use the same service-metric format as --disable-metric.
+	for _, metric := range s.DisabledMetrics {
+		if i := strings.Index(metric, "-"); i <= 0 || i == len(metric)-1 {
+			return fmt.Errorf("invalid disabled metric %q, expected service-metric (i.e: cinder-snapshots)", metric)
+		}
+	}
+
+	return nil
+}
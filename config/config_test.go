@@ -0,0 +1,115 @@
+package config
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+services: [compute, network, volume]
+disabled_metrics:
+  - cinder-snapshots
+disable_slow_metrics: true
+cache_ttl: 10m
+nova_metadata_extra_labels: [server_group=group]
+refresh_intervals:
+  compute: 30s
+  identity: 1h
+clouds:
+  prod:
+    disabled_metrics: []
+    domain_id: default
+  lab:
+    services: [compute]
+    disable_slow_metrics: false
+    nova_metadata_extra_labels: severity
+    refresh_intervals: {identity: 10m}
+    services_concurrency: 4
+`
+
+func TestLoad(t *testing.T) {
+	file := path.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(testConfig), 0o600))
+
+	config, err := Load(file)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"compute", "network", "volume"}, config.Services)
+	assert.Equal(t, []string{"cinder-snapshots"}, config.DisabledMetrics)
+	assert.Equal(t, 10*time.Minute, *config.CacheTTL)
+	assert.True(t, *config.DisableSlowMetrics)
+	assert.Nil(t, config.DisableDeprecatedMetrics)
+	assert.Equal(t, []string{"server_group"}, config.NovaMetadataMapping.Labels)
+	assert.Len(t, config.Clouds, 2)
+
+	_, err = Load(path.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestParseEmpty(t *testing.T) {
+	config, err := Parse(nil)
+	require.NoError(t, err)
+	assert.Equal(t, Settings{}, config.ForCloud("any"))
+}
+
+func TestParseInvalid(t *testing.T) {
+	for name, data := range map[string]string{
+		"unknown field":         "disable_metrics: [cinder-snapshots]",
+		"unknown service":       "services: [compute, nope]",
+		"unknown cloud service": "clouds: {prod: {services: [nope]}}",
+		"disabled metric":       "disabled_metrics: [snapshots]",
+		"cache ttl":             "cache_ttl: 0s",
+		"nova label":            "nova_metadata_extra_labels: [__bad]",
+		"refresh service":       "refresh_intervals: {nope: 1m}",
+		"services concurrency":  "clouds: {prod: {services_concurrency: 0}}",
+		"refresh interval":      "refresh_intervals: {compute: 0s}",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestForCloud(t *testing.T) {
+	config, err := Parse([]byte(testConfig))
+	require.NoError(t, err)
+
+	prod := config.ForCloud("prod")
+	assert.Equal(t, []string{"compute", "network", "volume"}, prod.Services)
+	assert.Empty(t, prod.DisabledMetrics)
+	assert.True(t, *prod.DisableSlowMetrics)
+	assert.Equal(t, "default", *prod.DomainID)
+	assert.Equal(t, []string{"server_group"}, prod.NovaMetadataMapping.Labels)
+
+	lab := config.ForCloud("lab")
+	assert.Equal(t, []string{"compute"}, lab.Services)
+	assert.Equal(t, []string{"cinder-snapshots"}, lab.DisabledMetrics)
+	assert.False(t, *lab.DisableSlowMetrics)
+	assert.Nil(t, lab.DomainID)
+	assert.Equal(t, []string{"severity"}, lab.NovaMetadataMapping.Labels)
+	assert.Equal(t, map[string]time.Duration{"compute": 30 * time.Second, "identity": 10 * time.Minute}, lab.RefreshIntervals)
+	assert.Equal(t, time.Hour, config.RefreshIntervals["identity"], "the global settings must not be modified")
+	assert.Equal(t, 4, *lab.ServicesConcurrency)
+	assert.Nil(t, prod.ServicesConcurrency)
+
+	assert.Equal(t, config.Settings, config.ForCloud("other"))
+
+	var none *Config
+	assert.Equal(t, Settings{}, none.ForCloud("other"))
+}
+
+func TestMerge(t *testing.T) {
+	enabled, disabled := true, false
+	base := Settings{DisabledMetrics: []string{"nova-flavors"}, DisableSlowMetrics: &disabled}
+
+	merged := base.Merge(Settings{DisableSlowMetrics: &enabled})
+	assert.Equal(t, []string{"nova-flavors"}, merged.DisabledMetrics)
+	assert.True(t, *merged.DisableSlowMetrics)
+	assert.False(t, *base.DisableSlowMetrics, "the base settings must not be modified")
+}
@@ -0,0 +1,162 @@
+package exporters
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// apiIDSegment matches the path segments which are IDs: UUIDs, hexadecimal or numeric IDs, and Swift accounts.
+var apiIDSegment = regexp.MustCompile(`^([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{16,}|[0-9]+|AUTH_.*)$`)
+
+type apiMetricsKey struct {
+	prefix string
+	cloud  string
+}
+
+var (
+	apiMetrics   = make(map[apiMetricsKey]*APIMetrics)
+	apiMetricsMu sync.Mutex
+)
+
+// APIMetrics tracks the requests made to the OpenStack APIs of a cloud.
+type APIMetrics struct {
+	duration *prometheus.HistogramVec
+	requests *prometheus.CounterVec
+	retries  *prometheus.CounterVec
+}
+
+// GetAPIMetrics returns the APIMetrics of the given cloud, creating it on first use.
+func GetAPIMetrics(prefix, cloud string) *APIMetrics {
+	apiMetricsMu.Lock()
+	defer apiMetricsMu.Unlock()
+
+	key := apiMetricsKey{prefix, cloud}
+	m, ok := apiMetrics[key]
+	if !ok {
+		m = NewAPIMetrics(prefix, cloud)
+		apiMetrics[key] = m
+	}
+
+	return m
+}
+
+func NewAPIMetrics(prefix, cloud string) *APIMetrics {
+	labels := []string{"service", "method", "url"}
+	constLabels := prometheus.Labels{"cloud": cloud}
+
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        fmt.Sprintf("%s_exporter_api_request_duration_seconds", prefix),
+		Help:        "Duration of the requests to the OpenStack API",
+		Buckets:     []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		ConstLabels: constLabels,
+	}, labels)
+
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        fmt.Sprintf("%s_exporter_api_requests_total", prefix),
+		Help:        "Total number of requests to the OpenStack API, by response code, error when no response was received",
+		ConstLabels: constLabels,
+	}, append(labels, "code"))
+
+	retries := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        fmt.Sprintf("%s_exporter_api_retries_total", prefix),
+		Help:        "Total number of retries of the requests to the OpenStack API which failed transiently, by reason",
+		ConstLabels: constLabels,
+	}, []string{"service", "reason"})
+
+	return &APIMetrics{
+		duration: duration,
+		requests: requests,
+		retries:  retries,
+	}
+}
+
+func (m *APIMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.duration.Describe(ch)
+	m.requests.Describe(ch)
+	m.retries.Describe(ch)
+}
+
+func (m *APIMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.duration.Collect(ch)
+	m.requests.Collect(ch)
+	m.retries.Collect(ch)
+}
+
+// observe records a request to the API of service.
+func (m *APIMetrics) observe(service, method, url, code string, duration time.Duration) {
+	m.duration.WithLabelValues(service, method, url).Observe(duration.Seconds())
+	m.requests.WithLabelValues(service, method, url, code).Inc()
+}
+
+// retry records that a request to the API of service is retried for reason.
+func (m *APIMetrics) retry(service, reason string) {
+	m.retries.WithLabelValues(service, reason).Inc()
+}
+
+// apiTransport is an http.RoundTripper recording the requests of a cloud in its APIMetrics.
+type apiTransport struct {
+	next      http.RoundTripper
+	metrics   *APIMetrics
+	endpoints *serviceEndpoints
+}
+
+// newAPITransport returns an apiTransport sending the requests with next, the default transport when nil.
+func newAPITransport(next http.RoundTripper, metrics *APIMetrics, endpoints *serviceEndpoints) *apiTransport {
+	return &apiTransport{
+		next:      withProxy(next),
+		metrics:   metrics,
+		endpoints: endpoints,
+	}
+}
+
+// withProxy returns transport using the proxy from the environment, the default transport when nil.
+// AuthenticatedClientV2 only sets the proxy of an http.Transport, so it is set before the transport is wrapped.
+func withProxy(transport http.RoundTripper) http.RoundTripper {
+	if transport == nil {
+		return http.DefaultTransport
+	}
+	if tr, ok := transport.(*http.Transport); ok {
+		tr.Proxy = http.ProxyFromEnvironment
+	}
+
+	return transport
+}
+
+func (t *apiTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	service := t.endpoints.service(req)
+	t.metrics.observe(service, req.Method, apiURLTemplate(service, req.URL.Path), code, time.Since(start))
+
+	return resp, err
+}
+
+// apiURLTemplate returns path with its IDs replaced by {id}, so that the requests to the same API share labels.
+// The container and object names following the account of the object store are replaced by {name}.
+func apiURLTemplate(service, path string) string {
+	segments := strings.Split(path, "/")
+	account := false
+	for i, segment := range segments {
+		switch {
+		case account && segment != "":
+			segments[i] = "{name}"
+		case apiIDSegment.MatchString(segment):
+			account = service == "object-store" && strings.HasPrefix(segment, "AUTH_")
+			segments[i] = "{id}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
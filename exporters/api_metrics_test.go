@@ -0,0 +1,54 @@
+package exporters
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIURLTemplate(t *testing.T) {
+	tests := []struct {
+		service  string
+		path     string
+		template string
+	}{
+		{"compute", "/compute/v2.1/servers/detail", "/compute/v2.1/servers/detail"},
+		{"compute", "/compute/v2.1/servers/0b5e8d8b-3c8e-4b7c-9b2a-1d2f3e4a5b6c/os-interface", "/compute/v2.1/servers/{id}/os-interface"},
+		{"identity", "/v3/projects/4b0d1a6d4b0b4a7c9f2d0c3b8e7a6f5d", "/v3/projects/{id}"},
+		{"compute", "/compute/v2.1/os-hypervisors/42", "/compute/v2.1/os-hypervisors/{id}"},
+		{"object-store", "/object-store/v1/AUTH_204bf5d6d658403b9d642adc408633af/backups/2024/db.tar", "/object-store/v1/{id}/{name}/{name}/{name}"},
+		{"object-store", "/object-store/v1/AUTH_204bf5d6d658403b9d642adc408633af", "/object-store/v1/{id}"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.template, apiURLTemplate(test.service, test.path), "path: %s", test.path)
+	}
+}
+
+func TestClientPoolAPIMetrics(t *testing.T) {
+	setupClientPoolTest(t)
+	logger := slog.New(slog.DiscardHandler)
+	pool := NewClientPool()
+	pool.SetMetricsPrefix("api_metrics_test")
+
+	httpmock.RegisterResponder("GET", "http://test.cloud/compute/v2.1/servers/0b5e8d8b-3c8e-4b7c-9b2a-1d2f3e4a5b6c",
+		httpmock.NewStringResponder(404, `{}`))
+
+	client, err := pool.ServiceClient(context.Background(), "compute", cloudName, "public", logger)
+	require.NoError(t, err)
+	_, err = client.Get(context.Background(), "http://test.cloud/compute/v2.1/servers/0b5e8d8b-3c8e-4b7c-9b2a-1d2f3e4a5b6c", nil, nil)
+	require.Error(t, err)
+
+	metrics := GetAPIMetrics("api_metrics_test", cloudName)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.requests.WithLabelValues("identity", http.MethodPost, "/v3/auth/tokens", "201")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.requests.WithLabelValues("compute", http.MethodGet, "/compute/v2.1/servers/{id}", "404")))
+	// The version discovery made when creating the client.
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.requests.WithLabelValues("compute", http.MethodGet, "/compute/", "200")))
+	assert.Equal(t, 3, testutil.CollectAndCount(metrics, "api_metrics_test_exporter_api_request_duration_seconds"))
+}
@@ -64,7 +64,7 @@ var defaultCinderMetrics = []Metric{
 func NewCinderExporter(config *ExporterConfig, logger *slog.Logger) (*CinderExporter, error) {
 	exporter := CinderExporter{
 		BaseOpenStackExporter{
-			Name:           "cinder",
+			Name:           exporterNames["volume"],
 			ExporterConfig: *config,
 			logger:         logger,
 		},
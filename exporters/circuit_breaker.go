@@ -0,0 +1,234 @@
+package exporters
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrCircuitOpen is returned when enabling the exporter of a service whose circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// States of a circuit breaker, the values of its state metric.
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+type breakerState int
+
+var singleCircuitBreakers *CircuitBreakers
+var circuitBreakersOnce sync.Once
+
+// CircuitBreakers keep a circuit breaker per service of every cloud. After a number of consecutive failed
+// collections of a service, the breaker opens and the service is not collected until its cool-down is over,
+// so that the scrapes do not wait for the timeouts of an API which is down. A single trial collection then decides
+// whether the breaker closes again or stays open for another cool-down.
+type CircuitBreakers struct {
+	mu sync.Mutex
+	// failures is the number of consecutive failures opening a breaker, the breakers are disabled when 0.
+	failures int
+	coolDown time.Duration
+	breakers map[circuitBreakerKey]*circuitBreaker
+}
+
+type circuitBreakerKey struct {
+	cloud   string
+	service string
+}
+
+// circuitBreaker is the breaker of a service of a cloud.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	failures int
+	coolDown time.Duration
+	// consecutive is the number of consecutive failed collections, openedAt when the breaker last opened.
+	consecutive int
+	open        bool
+	openedAt    time.Time
+	// probingAt is when the trial collection of the half-open breaker started, zero when none is running.
+	probingAt time.Time
+}
+
+// GetCircuitBreakers returns the singleton CircuitBreakers.
+func GetCircuitBreakers() *CircuitBreakers {
+	circuitBreakersOnce.Do(
+		func() {
+			singleCircuitBreakers = NewCircuitBreakers()
+		},
+	)
+
+	return singleCircuitBreakers
+}
+
+// NewCircuitBreakers returns disabled CircuitBreakers, enabled with SetPolicy.
+func NewCircuitBreakers() *CircuitBreakers {
+	return &CircuitBreakers{
+		breakers: make(map[circuitBreakerKey]*circuitBreaker),
+	}
+}
+
+// SetPolicy sets the number of consecutive failures opening a breaker, 0 disabling them, and how long it stays open.
+// The existing breakers are dropped.
+func (c *CircuitBreakers) SetPolicy(failures int, coolDown time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.failures = failures
+	c.coolDown = coolDown
+	c.breakers = make(map[circuitBreakerKey]*circuitBreaker)
+}
+
+// breaker returns the breaker of service of cloud, creating it on first use. It returns nil when disabled.
+func (c *CircuitBreakers) breaker(cloud, service string) *circuitBreaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.failures <= 0 {
+		return nil
+	}
+
+	key := circuitBreakerKey{cloud, service}
+	b, ok := c.breakers[key]
+	if !ok {
+		b = &circuitBreaker{failures: c.failures, coolDown: c.coolDown}
+		c.breakers[key] = b
+	}
+
+	return b
+}
+
+// allow reports whether the service can be collected, false while the breaker is open and cooling down.
+// Once half-open, it lets a single trial collection through and short-circuits the others until the trial
+// records its outcome, or for a cool-down if it never does.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.stateLocked(now) {
+	case breakerClosed:
+		return true
+	case breakerOpen:
+		return false
+	}
+
+	if !b.probingAt.IsZero() && now.Sub(b.probingAt) < b.coolDown {
+		return false
+	}
+	b.probingAt = now
+
+	return true
+}
+
+// record records the outcome of a collection of the service.
+func (b *circuitBreaker) record(success bool, now time.Time) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probingAt = time.Time{}
+	if success {
+		b.consecutive = 0
+		b.open = false
+		return
+	}
+
+	b.consecutive++
+	// A failure after the cool-down opens the breaker again for a whole cool-down.
+	if b.consecutive >= b.failures {
+		b.open = true
+		b.openedAt = now
+	}
+}
+
+func (b *circuitBreaker) state(now time.Time) breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.stateLocked(now)
+}
+
+// stateLocked returns the state of the breaker at now, b.mu must be held.
+func (b *circuitBreaker) stateLocked(now time.Time) breakerState {
+	switch {
+	case !b.open:
+		return breakerClosed
+	case now.Sub(b.openedAt) < b.coolDown:
+		return breakerOpen
+	}
+
+	return breakerHalfOpen
+}
+
+// recordEnableError records the failure to enable the exporter of a service. A service missing from the catalog
+// does not count as a failure, it is not collected anyway, but it ends the trial collection.
+func (b *circuitBreaker) recordEnableError(err error, now time.Time) {
+	if b == nil {
+		return
+	}
+
+	var endpointErr gophercloud.ErrEndpointNotFound
+	if errors.As(err, &endpointErr) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		b.probingAt = time.Time{}
+		return
+	}
+
+	b.record(false, now)
+}
+
+// circuitBreakerCollector exposes the state of the breakers of a cloud.
+type circuitBreakerCollector struct {
+	breakers *CircuitBreakers
+	cloud    string
+	state    *prometheus.Desc
+}
+
+// NewCircuitBreakerCollector returns a collector of the state of the circuit breakers of cloud.
+func NewCircuitBreakerCollector(prefix, cloud string) prometheus.Collector {
+	return &circuitBreakerCollector{
+		breakers: GetCircuitBreakers(),
+		cloud:    cloud,
+		state: prometheus.NewDesc(
+			fmt.Sprintf("%s_exporter_circuit_breaker_state", prefix),
+			"State of the circuit breaker of the service: 0 closed, 1 open, 2 half-open waiting for the next collection",
+			[]string{"service"}, prometheus.Labels{"cloud": cloud},
+		),
+	}
+}
+
+func (c *circuitBreakerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.state
+}
+
+func (c *circuitBreakerCollector) Collect(ch chan<- prometheus.Metric) {
+	c.breakers.mu.Lock()
+	breakers := make(map[string]*circuitBreaker)
+	for key, b := range c.breakers.breakers {
+		if key.cloud == c.cloud {
+			breakers[key.service] = b
+		}
+	}
+	c.breakers.mu.Unlock()
+
+	now := time.Now()
+	for _, service := range slices.Sorted(maps.Keys(breakers)) {
+		ch <- prometheus.MustNewConstMetric(c.state, prometheus.GaugeValue, float64(breakers[service].state(now)), service)
+	}
+}
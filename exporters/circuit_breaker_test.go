@@ -0,0 +1,89 @@
+package exporters
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	breakers := NewCircuitBreakers()
+	breakers.SetPolicy(3, time.Minute)
+	breaker := breakers.breaker("test", "volume")
+	now := time.Now()
+
+	breaker.record(false, now)
+	breaker.record(false, now)
+	assert.Equal(t, breakerClosed, breaker.state(now))
+	// A success resets the count of consecutive failures.
+	breaker.record(true, now)
+	breaker.record(false, now)
+	breaker.record(false, now)
+	assert.True(t, breaker.allow(now))
+
+	breaker.record(false, now)
+	assert.Equal(t, breakerOpen, breaker.state(now))
+	assert.False(t, breaker.allow(now.Add(59*time.Second)))
+
+	// After the cool-down a single trial collection is let through, a failure opens it again for a whole
+	// cool-down, a success closes it.
+	now = now.Add(time.Minute)
+	assert.Equal(t, breakerHalfOpen, breaker.state(now))
+	assert.True(t, breaker.allow(now))
+	assert.False(t, breaker.allow(now), "only one trial collection at a time")
+	breaker.record(false, now)
+	assert.False(t, breaker.allow(now.Add(59*time.Second)))
+
+	now = now.Add(time.Minute)
+	assert.True(t, breaker.allow(now))
+	assert.False(t, breaker.allow(now))
+	breaker.record(true, now)
+	assert.Equal(t, breakerClosed, breaker.state(now))
+	assert.True(t, breaker.allow(now))
+
+	// A trial which never records its outcome is given up after a cool-down.
+	for range 3 {
+		breaker.record(false, now)
+	}
+	now = now.Add(time.Minute)
+	assert.True(t, breaker.allow(now))
+	assert.False(t, breaker.allow(now.Add(59*time.Second)))
+	assert.True(t, breaker.allow(now.Add(time.Minute)))
+	breaker.record(true, now)
+
+	// A service missing from the catalog is not a failure.
+	for range 3 {
+		breaker.recordEnableError(gophercloud.ErrEndpointNotFound{}, now)
+	}
+	assert.Equal(t, breakerClosed, breaker.state(now))
+
+	breakers.SetPolicy(0, time.Minute)
+	assert.Nil(t, breakers.breaker("test", "volume"))
+	assert.True(t, breakers.breaker("test", "volume").allow(now))
+}
+
+func TestNewExporterCircuitOpen(t *testing.T) {
+	GetCircuitBreakers().SetPolicy(1, time.Minute)
+	t.Cleanup(func() { GetCircuitBreakers().SetPolicy(0, 0) })
+
+	GetCircuitBreakers().breaker("circuit_test", "volume").record(false, time.Now())
+
+	_, err := NewExporter(context.Background(), "volume", "openstack", "circuit_test", nil, "public", false, 0, false, false, false, "", "", nil, 0, nil, slog.New(slog.DiscardHandler))
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, enableErrorCircuitOpen, enableErrorReason(err))
+
+	expected := `
+# HELP openstack_exporter_circuit_breaker_state State of the circuit breaker of the service: 0 closed, 1 open, 2 half-open waiting for the next collection
+# TYPE openstack_exporter_circuit_breaker_state gauge
+openstack_exporter_circuit_breaker_state{cloud="circuit_test",service="volume"} 1
+`
+	err = testutil.CollectAndCompare(NewCircuitBreakerCollector("openstack", "circuit_test"), strings.NewReader(expected))
+	require.NoError(t, err)
+}
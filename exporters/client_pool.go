@@ -0,0 +1,391 @@
+package exporters
+
+import (
+	"context"
+	"crypto/sha256"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	gophercloudv2 "github.com/gophercloud/gophercloud/v2"
+	tokens2 "github.com/gophercloud/gophercloud/v2/openstack/identity/v2/tokens"
+	tokens3 "github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
+	clientconfigv2 "github.com/gophercloud/utils/v2/openstack/clientconfig"
+	"github.com/openstack-exporter/openstack-exporter/utils"
+	"golang.org/x/sync/singleflight"
+)
+
+// tokenExpiryMargin is how long before the Keystone token expires a pooled client re-authenticates.
+const tokenExpiryMargin = 1 * time.Minute
+
+// authenticateTimeout bounds the authentication of a cloud started by a caller without a deadline.
+const authenticateTimeout = 1 * time.Minute
+
+var singleClientPool *ClientPool
+var clientPoolOnce sync.Once
+
+// ClientPool keeps one authenticated ProviderClient per cloud together with the ServiceClients
+// created from it, so that exporters built on every scrape reuse the Keystone token and the
+// negotiated microversions instead of authenticating again.
+// The whole pool is invalidated when the content of clouds.yaml given to Reload changes, or when the
+// file set with SetConfigFile is modified.
+type ClientPool struct {
+	mu         sync.Mutex
+	configHash [sha256.Size]byte
+	// configFile is the clouds.yaml checked for modifications on every request, configState its last seen state.
+	configFile  string
+	configState configFileState
+	clouds      map[clientPoolKey]*pooledCloud
+	// metricsPrefix is the prefix of the APIMetrics recorded by the clients, none are recorded when empty.
+	metricsPrefix string
+	// rateLimits are applied to the requests of the clients of every cloud.
+	rateLimits RateLimits
+	// retries are the retries of the GET requests of the clients failing transiently.
+	retries Retries
+}
+
+// configFileState identifies a version of clouds.yaml without reading it.
+type configFileState struct {
+	modTime time.Time
+	size    int64
+}
+
+type clientPoolKey struct {
+	cloud        string
+	endpointType string
+}
+
+// pooledCloud holds the clients for a single cloud and endpoint type.
+// It is authenticated lazily so that a slow Keystone of one cloud does not block the others.
+type pooledCloud struct {
+	// auth shares the authentication of the cloud between the concurrent callers.
+	auth         singleflight.Group
+	mu           sync.Mutex
+	name         string
+	endpointType string
+	provider     *gophercloudv2.ProviderClient
+	cloud        *clientconfigv2.Cloud
+	eo           gophercloudv2.EndpointOpts
+	services     map[string]*gophercloudv2.ServiceClient
+	// endpoints finds the service of the requests of the clients.
+	endpoints *serviceEndpoints
+	// apiMetrics records the requests of the clients, when set.
+	apiMetrics *APIMetrics
+	rateLimits RateLimits
+	retries    Retries
+}
+
+// GetClientPool returns the singleton ClientPool.
+func GetClientPool() *ClientPool {
+	clientPoolOnce.Do(
+		func() {
+			singleClientPool = NewClientPool()
+		},
+	)
+
+	return singleClientPool
+}
+
+// NewClientPool returns an empty ClientPool.
+func NewClientPool() *ClientPool {
+	return &ClientPool{
+		clouds: make(map[clientPoolKey]*pooledCloud),
+	}
+}
+
+// SetMetricsPrefix sets the prefix of the APIMetrics of the clients created from now on.
+func (p *ClientPool) SetMetricsPrefix(prefix string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.metricsPrefix = prefix
+}
+
+// SetRateLimits sets the limits of the requests of the clients created from now on.
+func (p *ClientPool) SetRateLimits(limits RateLimits) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.rateLimits = limits
+}
+
+// SetRetries sets the retries of the requests of the clients created from now on.
+func (p *ClientPool) SetRetries(retries Retries) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.retries = retries
+}
+
+// SetConfigFile sets the clouds.yaml whose modifications drop every pooled client, none when empty.
+func (p *ClientPool) SetConfigFile(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.configFile = path
+	p.configState = p.statConfigFile()
+}
+
+// ServiceClient returns a ServiceClient for the service of the given cloud.
+// The returned client is a copy of the pooled one and can be modified by the caller,
+// it shares the ProviderClient and so the Keystone token with the pool.
+func (p *ClientPool) ServiceClient(ctx context.Context, service, cloud, endpointType string, logger *slog.Logger) (*gophercloudv2.ServiceClient, error) {
+	pc, err := p.cloudClients(cloud, endpointType, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := pc.authenticate(ctx, logger); err != nil {
+		return nil, err
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	sc, ok := pc.services[service]
+	if !ok {
+		sc, err = newServiceClientFromProviderV2(service, pc.provider, pc.cloud, pc.eo)
+		if err != nil {
+			return nil, err
+		}
+		pc.services[service] = sc
+		pc.endpoints.add(sc.Endpoint, service)
+		pc.endpoints.add(sc.ResourceBase, service)
+	}
+
+	client := *sc
+	return &client, nil
+}
+
+// ProviderClient returns the pooled ProviderClient of the given cloud and the EndpointOpts used for its services.
+func (p *ClientPool) ProviderClient(ctx context.Context, cloud, endpointType string, logger *slog.Logger) (*gophercloudv2.ProviderClient, gophercloudv2.EndpointOpts, error) {
+	pc, err := p.cloudClients(cloud, endpointType, logger)
+	if err != nil {
+		return nil, gophercloudv2.EndpointOpts{}, err
+	}
+
+	provider, err := pc.authenticate(ctx, logger)
+	if err != nil {
+		return nil, gophercloudv2.EndpointOpts{}, err
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	return provider, pc.eo, nil
+}
+
+// SetMicroversion stores the microversion negotiated for a service so later clients skip discovery.
+func (p *ClientPool) SetMicroversion(service, cloud, endpointType, microversion string) {
+	p.mu.Lock()
+	pc, ok := p.clouds[clientPoolKey{cloud, endpointType}]
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if sc, ok := pc.services[service]; ok {
+		sc.Microversion = microversion
+	}
+}
+
+// Invalidate drops the clients of the given cloud, for all endpoint types.
+func (p *ClientPool) Invalidate(cloud string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key := range p.clouds {
+		if key.cloud == cloud {
+			delete(p.clouds, key)
+		}
+	}
+}
+
+// InvalidateAll drops every pooled client.
+func (p *ClientPool) InvalidateAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clouds = make(map[clientPoolKey]*pooledCloud)
+}
+
+// Reload drops every pooled client when config, the content of clouds.yaml and of the credentials
+// completing it, changed since the last call. It returns whether the clients were dropped.
+func (p *ClientPool) Reload(config []byte, logger *slog.Logger) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hash := sha256.Sum256(config)
+	if hash == p.configHash {
+		return false
+	}
+	if len(p.clouds) > 0 {
+		logger.Info("Cloud configuration changed, dropping pooled OpenStack clients")
+	}
+	p.clouds = make(map[clientPoolKey]*pooledCloud)
+	p.configHash = hash
+	p.configState = p.statConfigFile()
+
+	return true
+}
+
+// checkConfigFile drops every pooled client when the configFile was modified since the last check, so that
+// the edited credentials are used without waiting for a reload. The caller must hold p.mu.
+func (p *ClientPool) checkConfigFile(logger *slog.Logger) {
+	state := p.statConfigFile()
+	if state == p.configState {
+		return
+	}
+	if len(p.clouds) > 0 {
+		logger.Info("clouds.yaml was modified, dropping pooled OpenStack clients")
+	}
+	p.clouds = make(map[clientPoolKey]*pooledCloud)
+	p.configState = state
+}
+
+// statConfigFile returns the state of the configFile, the zero state when it is not set or cannot be read.
+// The caller must hold p.mu.
+func (p *ClientPool) statConfigFile() configFileState {
+	if p.configFile == "" {
+		return configFileState{}
+	}
+	info, err := os.Stat(p.configFile)
+	if err != nil {
+		return configFileState{}
+	}
+
+	return configFileState{modTime: info.ModTime(), size: info.Size()}
+}
+
+// cloudClients returns the pooled clients of a cloud, creating an empty entry on first use.
+func (p *ClientPool) cloudClients(cloud, endpointType string, logger *slog.Logger) (*pooledCloud, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.checkConfigFile(logger)
+	key := clientPoolKey{cloud, endpointType}
+	pc, ok := p.clouds[key]
+	if !ok {
+		pc = &pooledCloud{
+			name:         cloud,
+			endpointType: endpointType,
+			services:     make(map[string]*gophercloudv2.ServiceClient),
+			endpoints:    newServiceEndpoints(),
+			rateLimits:   p.rateLimits,
+			retries:      p.retries,
+		}
+		if p.metricsPrefix != "" {
+			pc.apiMetrics = GetAPIMetrics(p.metricsPrefix, cloud)
+		}
+		p.clouds[key] = pc
+	}
+
+	return pc, nil
+}
+
+// authenticate returns the provider client, created on first use, after refreshing its token when needed.
+// The concurrent callers share the first authentication, which is not cancelled with the ctx of the caller
+// starting it, and each caller stops waiting for it when its own ctx is done. pc.mu is not held meanwhile.
+func (pc *pooledCloud) authenticate(ctx context.Context, logger *slog.Logger) (*gophercloudv2.ProviderClient, error) {
+	pc.mu.Lock()
+	provider := pc.provider
+	pc.mu.Unlock()
+	if provider != nil {
+		return provider, refreshToken(ctx, provider, logger)
+	}
+
+	ch := pc.auth.DoChan("", func() (any, error) {
+		ctx, cancel := utils.DetachContext(ctx, authenticateTimeout)
+		defer cancel()
+
+		return pc.newProvider(ctx, logger)
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*gophercloudv2.ProviderClient), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// newProvider authenticates a new provider client and stores it with the settings of the cloud.
+func (pc *pooledCloud) newProvider(ctx context.Context, logger *slog.Logger) (*gophercloudv2.ProviderClient, error) {
+	opts := clientconfigv2.ClientOpts{Cloud: pc.name}
+	config, err := clientconfigv2.GetCloudFromYAML(&opts)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := newTransport(config, logger)
+	if err != nil {
+		return nil, err
+	}
+	pc.endpoints.add(config.AuthInfo.AuthURL, "identity")
+	if pc.apiMetrics != nil {
+		transport = newAPITransport(transport, pc.apiMetrics, pc.endpoints)
+	}
+	// The requests waiting for their turn are part of the traces, but not of the API metrics.
+	// Every retry is a request of its own, waiting for its turn and recorded in the API metrics.
+	if pc.rateLimits.enabled() {
+		transport = newLimitTransport(transport, pc.rateLimits, pc.endpoints)
+	}
+	if pc.retries.Max > 0 {
+		transport = newRetryTransport(transport, pc.retries, pc.apiMetrics, pc.endpoints)
+	}
+	transport = newTracingTransport(withProxy(transport), pc.name)
+
+	logger.Debug("Authenticating pooled OpenStack client", "cloud", pc.name, "endpoint_type", pc.endpointType)
+	provider, cloudConfig, eo, err := newAuthenticatedProviderClient(ctx, &opts, transport, pc.endpointType)
+	if err != nil {
+		return nil, err
+	}
+	pc.endpoints.addCatalog(provider, eo)
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	pc.provider = provider
+	pc.cloud = cloudConfig
+	pc.eo = eo
+
+	return provider, nil
+}
+
+// refreshToken re-authenticates the provider client when its token is about to expire.
+// Gophercloud re-authenticates on a 401 as well, this just avoids the failed round trip.
+func refreshToken(ctx context.Context, provider *gophercloudv2.ProviderClient, logger *slog.Logger) error {
+	expiresAt, ok := tokenExpiresAt(provider)
+	if !ok || time.Until(expiresAt) > tokenExpiryMargin {
+		return nil
+	}
+
+	logger.Debug("Keystone token is about to expire, re-authenticating", "expires_at", expiresAt)
+	return provider.Reauthenticate(ctx, provider.Token())
+}
+
+// tokenExpiresAt returns the expiry time of the provider client's token, if known.
+func tokenExpiresAt(provider *gophercloudv2.ProviderClient) (time.Time, bool) {
+	switch r := provider.GetAuthResult().(type) {
+	case tokens3.CreateResult:
+		if token, err := r.ExtractToken(); err == nil {
+			return token.ExpiresAt, true
+		}
+	case tokens3.GetResult:
+		if token, err := r.ExtractToken(); err == nil {
+			return token.ExpiresAt, true
+		}
+	case tokens2.CreateResult:
+		if token, err := r.ExtractToken(); err == nil {
+			return token.ExpiresAt, true
+		}
+	}
+
+	return time.Time{}, false
+}
@@ -0,0 +1,184 @@
+package exporters
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupClientPoolTest(t *testing.T) {
+	httpmock.Activate()
+	t.Cleanup(httpmock.DeactivateAndReset)
+
+	t.Setenv("OS_CLIENT_CONFIG_FILE", path.Join(baseFixturePath, "test_config.yaml"))
+
+	tokens, err := os.ReadFile(path.Join(baseFixturePath, "tokens.json"))
+	require.NoError(t, err)
+	httpmock.RegisterResponder("POST", "http://test.cloud:35357/v3/auth/tokens",
+		httpmock.NewBytesResponder(201, tokens).HeaderSet(map[string][]string{
+			"X-Subject-Token": {"1234"},
+		}))
+	// Validation of the token, returning the current catalog.
+	httpmock.RegisterResponder("GET", "http://test.cloud:35357/v3/auth/tokens",
+		httpmock.NewBytesResponder(200, tokens).HeaderSet(map[string][]string{
+			"X-Subject-Token": {"1234"},
+		}))
+
+	// Endpoint discovery done by gophercloud when creating the clients.
+	for url, fixture := range map[string]string{
+		"http://test.cloud/compute/": "nova_api_discovery.json",
+		"http://test.cloud/neutron/": "neutron_api_discovery.json",
+	} {
+		discovery, err := os.ReadFile(path.Join(baseFixturePath, fixture))
+		require.NoError(t, err)
+		httpmock.RegisterResponder("GET", url, httpmock.NewBytesResponder(200, discovery))
+	}
+}
+
+func TestClientPoolReusesProviderClient(t *testing.T) {
+	setupClientPoolTest(t)
+	logger := slog.New(slog.DiscardHandler)
+	pool := NewClientPool()
+
+	compute, err := pool.ServiceClient(context.Background(), "compute", cloudName, "public", logger)
+	require.NoError(t, err)
+	network, err := pool.ServiceClient(context.Background(), "network", cloudName, "public", logger)
+	require.NoError(t, err)
+
+	assert.Same(t, compute.ProviderClient, network.ProviderClient)
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["POST http://test.cloud:35357/v3/auth/tokens"])
+
+	pool.Invalidate(cloudName)
+	_, err = pool.ServiceClient(context.Background(), "compute", cloudName, "public", logger)
+	require.NoError(t, err)
+	assert.Equal(t, 2, httpmock.GetCallCountInfo()["POST http://test.cloud:35357/v3/auth/tokens"])
+}
+
+func TestClientPoolRemembersMicroversion(t *testing.T) {
+	setupClientPoolTest(t)
+	logger := slog.New(slog.DiscardHandler)
+	pool := NewClientPool()
+
+	client, err := pool.ServiceClient(context.Background(), "compute", cloudName, "public", logger)
+	require.NoError(t, err)
+	assert.Empty(t, client.Microversion)
+
+	// Changing the returned copy must not affect the pooled client.
+	client.Microversion = "2.1"
+	client, err = pool.ServiceClient(context.Background(), "compute", cloudName, "public", logger)
+	require.NoError(t, err)
+	assert.Empty(t, client.Microversion)
+
+	pool.SetMicroversion("compute", cloudName, "public", "2.87")
+	client, err = pool.ServiceClient(context.Background(), "compute", cloudName, "public", logger)
+	require.NoError(t, err)
+	assert.Equal(t, "2.87", client.Microversion)
+}
+
+func TestClientPoolInvalidatedOnConfigChange(t *testing.T) {
+	setupClientPoolTest(t)
+	logger := slog.New(slog.DiscardHandler)
+	pool := NewClientPool()
+
+	config, err := os.ReadFile(path.Join(baseFixturePath, "test_config.yaml"))
+	require.NoError(t, err)
+	configPath := path.Join(t.TempDir(), "clouds.yaml")
+	require.NoError(t, os.WriteFile(configPath, config, 0o600))
+	t.Setenv("OS_CLIENT_CONFIG_FILE", configPath)
+	assert.True(t, pool.Reload(config, logger))
+
+	_, err = pool.ServiceClient(context.Background(), "compute", cloudName, "public", logger)
+	require.NoError(t, err)
+	_, err = pool.ServiceClient(context.Background(), "compute", cloudName, "public", logger)
+	require.NoError(t, err)
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["POST http://test.cloud:35357/v3/auth/tokens"])
+
+	// Reloading an unchanged configuration keeps the clients.
+	assert.False(t, pool.Reload(config, logger))
+	_, err = pool.ServiceClient(context.Background(), "compute", cloudName, "public", logger)
+	require.NoError(t, err)
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["POST http://test.cloud:35357/v3/auth/tokens"])
+
+	config = append(config, []byte("\n    interface: public\n")...)
+	require.NoError(t, os.WriteFile(configPath, config, 0o600))
+	assert.True(t, pool.Reload(config, logger))
+	_, err = pool.ServiceClient(context.Background(), "compute", cloudName, "public", logger)
+	require.NoError(t, err)
+	assert.Equal(t, 2, httpmock.GetCallCountInfo()["POST http://test.cloud:35357/v3/auth/tokens"])
+}
+
+func TestClientPoolAuthenticationHonoursContext(t *testing.T) {
+	setupClientPoolTest(t)
+	logger := slog.New(slog.DiscardHandler)
+	pool := NewClientPool()
+
+	tokens, err := os.ReadFile(path.Join(baseFixturePath, "tokens.json"))
+	require.NoError(t, err)
+	release := make(chan struct{})
+	httpmock.RegisterResponder("POST", "http://test.cloud:35357/v3/auth/tokens", func(req *http.Request) (*http.Response, error) {
+		<-release
+		resp := httpmock.NewBytesResponse(201, tokens)
+		resp.Header.Set("X-Subject-Token", "1234")
+		return resp, nil
+	})
+
+	// The scrapes of a cloud whose Keystone hangs give up at their deadline, without blocking each other.
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Go(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			_, err := pool.ServiceClient(ctx, "compute", cloudName, "public", logger)
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+			assert.Less(t, time.Since(start), time.Second)
+		})
+	}
+	wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err = pool.ProviderClient(ctx, cloudName, "public", logger)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Once Keystone answers again, the cloud is authenticated, after the failure of the authentication in flight.
+	close(release)
+	require.Eventually(t, func() bool {
+		_, err := pool.ServiceClient(context.Background(), "compute", cloudName, "public", logger)
+		return err == nil
+	}, time.Second, time.Millisecond)
+}
+
+func TestClientPoolInvalidatedOnConfigFileChange(t *testing.T) {
+	setupClientPoolTest(t)
+	logger := slog.New(slog.DiscardHandler)
+	pool := NewClientPool()
+
+	config, err := os.ReadFile(path.Join(baseFixturePath, "test_config.yaml"))
+	require.NoError(t, err)
+	configPath := path.Join(t.TempDir(), "clouds.yaml")
+	require.NoError(t, os.WriteFile(configPath, config, 0o600))
+	t.Setenv("OS_CLIENT_CONFIG_FILE", configPath)
+	pool.SetConfigFile(configPath)
+
+	for range 2 {
+		_, err = pool.ServiceClient(context.Background(), "compute", cloudName, "public", logger)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["POST http://test.cloud:35357/v3/auth/tokens"])
+
+	// The modified file is used without a reload.
+	require.NoError(t, os.WriteFile(configPath, append(config, []byte("\n    interface: public\n")...), 0o600))
+	_, err = pool.ServiceClient(context.Background(), "compute", cloudName, "public", logger)
+	require.NoError(t, err)
+	assert.Equal(t, 2, httpmock.GetCallCountInfo()["POST http://test.cloud:35357/v3/auth/tokens"])
+}
@@ -0,0 +1,141 @@
+package exporters
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons a ListFunc failed, used as the reason label of the collector errors counter.
+const (
+	collectErrorTimeout   = "timeout"
+	collectErrorCanceled  = "canceled"
+	collectErrorHTTP403   = "http_403"
+	collectErrorHTTP404   = "http_404"
+	collectErrorHTTP5xx   = "http_5xx"
+	collectErrorHTTPOther = "http_other"
+	collectErrorDecode    = "decode_error"
+	collectErrorOther     = "other"
+)
+
+type collectorMetricsKey struct {
+	prefix string
+	cloud  string
+}
+
+var (
+	collectorMetrics   = make(map[collectorMetricsKey]*CollectorMetrics)
+	collectorMetricsMu sync.Mutex
+)
+
+// CollectorMetrics tracks the outcome of every ListFunc of the exporters of a cloud.
+// Exporters are created for every scrape, so these metrics are kept aside to survive across scrapes.
+type CollectorMetrics struct {
+	success  *prometheus.GaugeVec
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+// GetCollectorMetrics returns the CollectorMetrics of the given cloud, creating it on first use.
+func GetCollectorMetrics(prefix, cloud string) *CollectorMetrics {
+	collectorMetricsMu.Lock()
+	defer collectorMetricsMu.Unlock()
+
+	key := collectorMetricsKey{prefix, cloud}
+	m, ok := collectorMetrics[key]
+	if !ok {
+		m = NewCollectorMetrics(prefix)
+		collectorMetrics[key] = m
+	}
+
+	return m
+}
+
+func NewCollectorMetrics(prefix string) *CollectorMetrics {
+	labels := []string{"service", "metric"}
+
+	success := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: fmt.Sprintf("%s_exporter_collector_success", prefix),
+		Help: "Whether the last collection of the metric from OpenStack API succeeded",
+	}, labels)
+
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    fmt.Sprintf("%s_exporter_collector_duration_seconds", prefix),
+		Help:    "Duration of the collection of the metric from OpenStack API",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, labels)
+
+	collectErrors := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: fmt.Sprintf("%s_exporter_collector_errors_total", prefix),
+		Help: "Total number of failed collections of the metric from OpenStack API, by reason",
+	}, append(labels, "reason"))
+
+	return &CollectorMetrics{
+		success:  success,
+		duration: duration,
+		errors:   collectErrors,
+	}
+}
+
+func (m *CollectorMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.success.Describe(ch)
+	m.duration.Describe(ch)
+	m.errors.Describe(ch)
+}
+
+func (m *CollectorMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.success.Collect(ch)
+	m.duration.Collect(ch)
+	m.errors.Collect(ch)
+}
+
+// observe records the result of a ListFunc run.
+func (m *CollectorMetrics) observe(service, metric string, duration time.Duration, err error) {
+	m.duration.WithLabelValues(service, metric).Observe(duration.Seconds())
+
+	if err != nil {
+		m.success.WithLabelValues(service, metric).Set(0)
+		m.errors.WithLabelValues(service, metric, collectErrorReason(err)).Inc()
+		return
+	}
+
+	m.success.WithLabelValues(service, metric).Set(1)
+}
+
+// collectErrorReason classifies the error returned by a ListFunc.
+func collectErrorReason(err error) string {
+	var codeErr gophercloud.ErrUnexpectedResponseCode
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return collectErrorTimeout
+	case errors.Is(err, context.Canceled):
+		return collectErrorCanceled
+	case errors.As(err, &codeErr):
+		switch {
+		case codeErr.Actual == 403:
+			return collectErrorHTTP403
+		case codeErr.Actual == 404:
+			return collectErrorHTTP404
+		case codeErr.Actual >= 500:
+			return collectErrorHTTP5xx
+		}
+		return collectErrorHTTPOther
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return collectErrorTimeout
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return collectErrorDecode
+	}
+
+	return collectErrorOther
+}
@@ -0,0 +1,72 @@
+package exporters
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectErrorReason(t *testing.T) {
+	tests := []struct {
+		err    error
+		reason string
+	}{
+		{context.DeadlineExceeded, collectErrorTimeout},
+		{fmt.Errorf("request failed: %w", context.DeadlineExceeded), collectErrorTimeout},
+		{context.Canceled, collectErrorCanceled},
+		{gophercloud.ErrUnexpectedResponseCode{Actual: 403}, collectErrorHTTP403},
+		{gophercloud.ErrUnexpectedResponseCode{Actual: 404}, collectErrorHTTP404},
+		{gophercloud.ErrUnexpectedResponseCode{Actual: 503}, collectErrorHTTP5xx},
+		{gophercloud.ErrUnexpectedResponseCode{Actual: 409}, collectErrorHTTPOther},
+		{json.Unmarshal([]byte("{"), &struct{}{}), collectErrorDecode},
+		{json.Unmarshal([]byte(`{"id": 1}`), &struct{ ID string }{}), collectErrorDecode},
+		{errors.New("boom"), collectErrorOther},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.reason, collectErrorReason(test.err), "error: %v", test.err)
+	}
+}
+
+func TestCollectorMetrics(t *testing.T) {
+	exporter := BaseOpenStackExporter{
+		Name: "cinder",
+		ExporterConfig: ExporterConfig{
+			Prefix:           "openstack",
+			collectorMetrics: NewCollectorMetrics("openstack"),
+		},
+		logger: slog.New(slog.DiscardHandler),
+	}
+	exporter.AddMetric("volumes", func(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+		return nil
+	}, nil, "", nil)
+	exporter.AddMetric("limits_volume_max_gb", func(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+		return gophercloud.ErrUnexpectedResponseCode{Actual: 403}
+	}, nil, "", nil)
+
+	testutil.CollectAndCount(&exporter)
+
+	expected := `
+# HELP openstack_exporter_collector_errors_total Total number of failed collections of the metric from OpenStack API, by reason
+# TYPE openstack_exporter_collector_errors_total counter
+openstack_exporter_collector_errors_total{metric="limits_volume_max_gb",reason="http_403",service="cinder"} 1
+# HELP openstack_exporter_collector_success Whether the last collection of the metric from OpenStack API succeeded
+# TYPE openstack_exporter_collector_success gauge
+openstack_exporter_collector_success{metric="limits_volume_max_gb",service="cinder"} 0
+openstack_exporter_collector_success{metric="volumes",service="cinder"} 1
+`
+	err := testutil.CollectAndCompare(exporter.collectorMetrics, strings.NewReader(expected),
+		"openstack_exporter_collector_errors_total", "openstack_exporter_collector_success")
+	require.NoError(t, err)
+	assert.Equal(t, 2, testutil.CollectAndCount(exporter.collectorMetrics, "openstack_exporter_collector_duration_seconds"))
+}
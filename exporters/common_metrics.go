@@ -2,55 +2,66 @@ package exporters
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/common/version"
+	dto "github.com/prometheus/client_model/go"
 )
 
+var (
+	commonMetricsExporters   = make(map[collectorMetricsKey]*CommonMetricsExporter)
+	commonMetricsExportersMu sync.Mutex
+)
+
+// CommonMetricsExporter exposes metrics about the scrapes of a cloud.
 type CommonMetricsExporter struct {
 	totalScrapes   prometheus.Counter
 	scrapeDuration prometheus.Histogram
 	scrapeErrors   prometheus.Counter
-	buildInfo      prometheus.Metric
 }
 
-func NewCommonMetricsExporter(prefix string) *CommonMetricsExporter {
+// GetCommonMetricsExporter returns the CommonMetricsExporter of the given cloud, creating it on first use.
+func GetCommonMetricsExporter(prefix, cloud string) *CommonMetricsExporter {
+	commonMetricsExportersMu.Lock()
+	defer commonMetricsExportersMu.Unlock()
+
+	key := collectorMetricsKey{prefix, cloud}
+	e, ok := commonMetricsExporters[key]
+	if !ok {
+		e = NewCommonMetricsExporter(prefix, cloud)
+		commonMetricsExporters[key] = e
+	}
+
+	return e
+}
+
+func NewCommonMetricsExporter(prefix, cloud string) *CommonMetricsExporter {
+	constLabels := prometheus.Labels{"cloud": cloud}
+
 	totalScrapes := prometheus.NewCounter(prometheus.CounterOpts{
-		Name: fmt.Sprintf("%s_exporter_scrapes_total", prefix),
-		Help: "Total number of scrapes",
+		Name:        fmt.Sprintf("%s_exporter_scrapes_total", prefix),
+		Help:        "Total number of scrapes",
+		ConstLabels: constLabels,
 	})
 
 	scrapeDuration := prometheus.NewHistogram(prometheus.HistogramOpts{
-		Name:    fmt.Sprintf("%s_exporter_scrape_duration_miliseconds", prefix),
-		Help:    "Duration of scrapes",
-		Buckets: []float64{500, 750, 1000, 5000, 10000, 30000},
+		Name:        fmt.Sprintf("%s_exporter_scrape_duration_seconds", prefix),
+		Help:        "Duration of scrapes",
+		Buckets:     []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120},
+		ConstLabels: constLabels,
 	})
 
 	scrapeErrors := prometheus.NewCounter(prometheus.CounterOpts{
-		Name: fmt.Sprintf("%s_exporter_scrape_errors_total", prefix),
-		Help: "Total number of scrape errors",
+		Name:        fmt.Sprintf("%s_exporter_scrape_errors_total", prefix),
+		Help:        "Total number of scrape errors",
+		ConstLabels: constLabels,
 	})
 
-	buildInfo := prometheus.MustNewConstMetric(
-		prometheus.NewDesc(
-			fmt.Sprintf("%s_exporter_build_info", prefix),
-			"A metric with a constant '1' value labeled by version, revision, branch, and goversion.",
-			nil,
-			prometheus.Labels{
-				"version":   version.Version,
-				"revision":  version.Revision,
-				"branch":    version.Branch,
-				"goversion": version.GoVersion,
-			},
-		),
-		prometheus.GaugeValue, 1,
-	)
-
 	return &CommonMetricsExporter{
 		totalScrapes:   totalScrapes,
 		scrapeDuration: scrapeDuration,
 		scrapeErrors:   scrapeErrors,
-		buildInfo:      buildInfo,
 	}
 }
 
@@ -58,14 +69,12 @@ func (e *CommonMetricsExporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- e.totalScrapes.Desc()
 	ch <- e.scrapeDuration.Desc()
 	ch <- e.scrapeErrors.Desc()
-	ch <- e.buildInfo.Desc()
 }
 
 func (e *CommonMetricsExporter) Collect(ch chan<- prometheus.Metric) {
 	ch <- e.totalScrapes
 	ch <- e.scrapeDuration
 	ch <- e.scrapeErrors
-	ch <- e.buildInfo
 }
 
 func (e *CommonMetricsExporter) MetricIsDisabled(name string) bool {
@@ -83,3 +92,22 @@ func (e *CommonMetricsExporter) ScrapeDuration() prometheus.Histogram {
 func (e *CommonMetricsExporter) ScrapeErrors() prometheus.Counter {
 	return e.scrapeErrors
 }
+
+// ObserveScrape records a scrape that started at start and ended with err.
+func (e *CommonMetricsExporter) ObserveScrape(start time.Time, err error) {
+	e.totalScrapes.Inc()
+	e.scrapeDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		e.scrapeErrors.Inc()
+	}
+}
+
+// InstrumentGatherer returns a Gatherer recording every Gather of g as a scrape.
+func (e *CommonMetricsExporter) InstrumentGatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		start := time.Now()
+		mfs, err := g.Gather()
+		e.ObserveScrape(start, err)
+		return mfs, err
+	})
+}
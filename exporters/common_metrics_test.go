@@ -1,19 +1,22 @@
 package exporters
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestCommonMetricsExporter(t *testing.T) {
-	exporter := NewCommonMetricsExporter("test")
+	exporter := NewCommonMetricsExporter("test", "test.cloud")
 
 	exporter.TotalScrapes().Inc()
 	exporter.ScrapeErrors().Add(2)
-	exporter.ScrapeDuration().Observe(1234)
+	exporter.ScrapeDuration().Observe(1.234)
 
 	// Register to a test registry
 	reg := prometheus.NewRegistry()
@@ -24,10 +27,9 @@ func TestCommonMetricsExporter(t *testing.T) {
 	assert.NoError(t, err)
 
 	metricsMap := map[string]bool{
-		"test_exporter_scrapes_total":               false,
-		"test_exporter_scrape_errors_total":         false,
-		"test_exporter_scrape_duration_miliseconds": false,
-		"test_exporter_build_info":                  false,
+		"test_exporter_scrapes_total":           false,
+		"test_exporter_scrape_errors_total":     false,
+		"test_exporter_scrape_duration_seconds": false,
 	}
 
 	for _, mf := range metrics {
@@ -42,12 +44,38 @@ func TestCommonMetricsExporter(t *testing.T) {
 }
 
 func TestCommonMetricsExporterScrapeCounters(t *testing.T) {
-	exporter := NewCommonMetricsExporter("unit")
+	exporter := NewCommonMetricsExporter("unit", "test.cloud")
 
 	exporter.TotalScrapes().Inc()
 	exporter.ScrapeErrors().Add(5)
-	exporter.ScrapeDuration().Observe(1000)
+	exporter.ScrapeDuration().Observe(1)
 
 	assert.Equal(t, float64(1), testutil.ToFloat64(exporter.TotalScrapes()))
 	assert.Equal(t, float64(5), testutil.ToFloat64(exporter.ScrapeErrors()))
 }
+
+func TestCommonMetricsExporterInstrumentGatherer(t *testing.T) {
+	exporter := NewCommonMetricsExporter("unit", "test.cloud")
+
+	reg := prometheus.NewRegistry()
+	_, err := exporter.InstrumentGatherer(reg).Gather()
+	assert.NoError(t, err)
+
+	failing := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return nil, errors.New("gather failed")
+	})
+	_, err = exporter.InstrumentGatherer(failing).Gather()
+	assert.Error(t, err)
+
+	expected := `
+# HELP unit_exporter_scrape_errors_total Total number of scrape errors
+# TYPE unit_exporter_scrape_errors_total counter
+unit_exporter_scrape_errors_total{cloud="test.cloud"} 1
+# HELP unit_exporter_scrapes_total Total number of scrapes
+# TYPE unit_exporter_scrapes_total counter
+unit_exporter_scrapes_total{cloud="test.cloud"} 2
+`
+	assert.NoError(t, testutil.CollectAndCompare(exporter, strings.NewReader(expected),
+		"unit_exporter_scrapes_total", "unit_exporter_scrape_errors_total"))
+	assert.Equal(t, 1, testutil.CollectAndCount(exporter, "unit_exporter_scrape_duration_seconds"))
+}
@@ -48,7 +48,7 @@ var defaultContainerInfraMetrics = []Metric{
 func NewContainerInfraExporter(config *ExporterConfig, logger *slog.Logger) (*ContainerInfraExporter, error) {
 	exporter := ContainerInfraExporter{
 		BaseOpenStackExporter{
-			Name:           "container_infra",
+			Name:           exporterNames["container-infra"],
 			ExporterConfig: *config,
 			logger:         logger,
 		},
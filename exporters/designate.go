@@ -58,7 +58,7 @@ func NewDesignateExporter(config *ExporterConfig, logger *slog.Logger) (*Designa
 	exporter := DesignateExporter{
 		BaseOpenStackExporter{
 			ExporterConfig: *config,
-			Name:           "designate",
+			Name:           exporterNames["dns"],
 			logger:         logger,
 		},
 	}
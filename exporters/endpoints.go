@@ -0,0 +1,64 @@
+package exporters
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gophercloud/gophercloud/v2"
+)
+
+// apiServiceUnknown is the service of the requests to an endpoint of no known service.
+const apiServiceUnknown = "unknown"
+
+// serviceEndpoints finds the service of the requests of a cloud from the endpoints added for its services.
+type serviceEndpoints struct {
+	mu        sync.RWMutex
+	endpoints map[string]string
+}
+
+func newServiceEndpoints() *serviceEndpoints {
+	return &serviceEndpoints{endpoints: make(map[string]string)}
+}
+
+// add records that the requests to the URLs under endpoint are made to the API of service.
+func (e *serviceEndpoints) add(endpoint, service string) {
+	if endpoint == "" {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.endpoints[strings.TrimSuffix(endpoint, "/")] = service
+}
+
+// addCatalog adds the endpoints of the supported services found in the catalog of providerClient.
+func (e *serviceEndpoints) addCatalog(providerClient *gophercloud.ProviderClient, endpointOpts gophercloud.EndpointOpts) {
+	for _, service := range SupportedExporters {
+		for _, serviceType := range serviceCatalogTypesByExporterService[service] {
+			eo := endpointOpts
+			eo.ApplyDefaults(serviceType)
+			if endpoint, err := providerClient.EndpointLocator(eo); err == nil {
+				e.add(endpoint, service)
+			}
+		}
+	}
+}
+
+// service returns the service of the longest endpoint the request URL is under.
+func (e *serviceEndpoints) service(req *http.Request) string {
+	url := req.URL.Scheme + "://" + req.URL.Host + req.URL.Path
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	service, longest := apiServiceUnknown, -1
+	for endpoint, s := range e.endpoints {
+		if len(endpoint) > longest && (url == endpoint || strings.HasPrefix(url, endpoint+"/")) {
+			service, longest = s, len(endpoint)
+		}
+	}
+
+	return service
+}
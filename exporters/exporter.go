@@ -3,6 +3,7 @@ package exporters
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -19,6 +20,8 @@ import (
 	"github.com/mitchellh/go-homedir"
 	"github.com/openstack-exporter/openstack-exporter/utils"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -41,7 +44,27 @@ const (
 	TERABYTE
 )
 
-var SupportedExporters = []string{"network", "compute", "image", "volume", "identity", "object-store", "load-balancer", "container-infra", "dns", "baremetal", "gnocchi", "database", "orchestration", "placement", "sharev2"}
+var SupportedExporters = []string{"network", "compute", "image", "volume", "identity", "object-store", "load-balancer", "container-infra", "dns", "baremetal", "gnocchi", "database", "orchestration", "placement", "sharev2", "instance-ha"}
+
+// exporterNames are the names of the exporters of the services, used in their metric names.
+var exporterNames = map[string]string{
+	"network":         "neutron",
+	"compute":         "nova",
+	"image":           "glance",
+	"volume":          "cinder",
+	"identity":        "identity",
+	"object-store":    "object_store",
+	"load-balancer":   "loadbalancer",
+	"container-infra": "container_infra",
+	"dns":             "designate",
+	"baremetal":       "ironic",
+	"gnocchi":         "gnocchi",
+	"database":        "trove",
+	"orchestration":   "heat",
+	"placement":       "placement",
+	"sharev2":         "sharev2",
+	"instance-ha":     "masakari",
+}
 
 type OpenStackExporter interface {
 	prometheus.Collector
@@ -51,8 +74,8 @@ type OpenStackExporter interface {
 	MetricIsDisabled(name string) bool
 }
 
-func EnableExporter(service, prefix, cloud string, disabledMetrics []string, endpointType string, collectTime bool, disableSlowMetrics bool, disableDeprecatedMetrics bool, disableCinderAgentUUID bool, domainID string, tenantID string, novaMetadataMapping *utils.LabelMappingFlag, dnsConcurrentCount int, uuidGenFunc func() (string, error), logger *slog.Logger) (*OpenStackExporter, error) {
-	exporter, err := NewExporter(service, prefix, cloud, disabledMetrics, endpointType, collectTime, disableSlowMetrics, disableDeprecatedMetrics, disableCinderAgentUUID, domainID, tenantID, novaMetadataMapping, dnsConcurrentCount, uuidGenFunc, logger)
+func EnableExporter(ctx context.Context, service, prefix, cloud string, disabledMetrics []string, endpointType string, collectTime bool, metricTimeout time.Duration, disableSlowMetrics bool, disableDeprecatedMetrics bool, disableCinderAgentUUID bool, domainID string, tenantID string, novaMetadataMapping *utils.LabelMappingFlag, dnsConcurrentCount int, uuidGenFunc func() (string, error), logger *slog.Logger) (*OpenStackExporter, error) {
+	exporter, err := NewExporter(ctx, service, prefix, cloud, disabledMetrics, endpointType, collectTime, metricTimeout, disableSlowMetrics, disableDeprecatedMetrics, disableCinderAgentUUID, domainID, tenantID, novaMetadataMapping, dnsConcurrentCount, uuidGenFunc, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -70,6 +93,7 @@ type ExporterConfig struct {
 	Prefix                   string
 	DisabledMetrics          []string
 	CollectTime              bool
+	MetricTimeout            time.Duration
 	UUIDGenFunc              func() (string, error)
 	DisableSlowMetrics       bool
 	DisableDeprecatedMetrics bool
@@ -78,6 +102,22 @@ type ExporterConfig struct {
 	TenantID                 string
 	NovaMetadataMapping      *utils.LabelMappingFlag
 	DnsConcurrentCount       int
+
+	// ctx is the context of the scrape the exporter was created for.
+	// Collect has no context parameter, so it is carried here.
+	ctx context.Context
+	// collectorMetrics records the outcome of each ListFunc, it is nil when not tracked.
+	collectorMetrics *CollectorMetrics
+	// breaker records the outcome of the collections of the service, it is nil when disabled.
+	breaker *circuitBreaker
+}
+
+// scrapeContext returns the context of the scrape, or a background context when there is none.
+func (config *ExporterConfig) scrapeContext() context.Context {
+	if config.ctx == nil {
+		return context.Background()
+	}
+	return config.ctx
 }
 
 type BaseOpenStackExporter struct {
@@ -113,14 +153,36 @@ func (exporter *BaseOpenStackExporter) Describe(ch chan<- *prometheus.Desc) {
 	}
 }
 
-func (exporter *BaseOpenStackExporter) RunCollection(metric *PrometheusMetric, metricName string, ch chan<- prometheus.Metric, logger *slog.Logger) error {
-	ctx := context.TODO()
+func (exporter *BaseOpenStackExporter) RunCollection(ctx context.Context, metric *PrometheusMetric, metricName string, ch chan<- prometheus.Metric, logger *slog.Logger) error {
+	if exporter.MetricTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, exporter.MetricTimeout)
+		defer cancel()
+	}
+
+	ctx, span := tracer.Start(ctx, "RunCollection", trace.WithAttributes(
+		attributeService.String(exporter.ServiceName),
+		attributeMetric.String(metricName),
+	))
+	defer span.End()
 
 	exporter.logger.Info("Collecting metrics for exporter", "exporter", exporter.GetName(), "metrics", metricName)
 	now := time.Now()
-	err := metric.Fn(ctx, exporter, ch)
+	err := exporter.runListFunc(ctx, metric, ch)
+	if exporter.collectorMetrics != nil {
+		exporter.collectorMetrics.observe(exporter.Name, metricName, time.Since(now), err)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to collect metric: %s, error: %s", metricName, err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		ch <- prometheus.MustNewConstMetric(exporter.Metrics["openstack_metric_collect_timeout"].Metric, prometheus.GaugeValue, 1, metricName)
+		return fmt.Errorf("timed out collecting metric: %s after %s: %w", metricName, time.Since(now).Round(time.Millisecond), err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to collect metric: %s, error: %w", metricName, err)
 	}
 
 	exporter.logger.Info("Collected metrics for exporter", "exporter", exporter.GetName(), "metrics", metricName)
@@ -131,7 +193,42 @@ func (exporter *BaseOpenStackExporter) RunCollection(metric *PrometheusMetric, m
 	return nil
 }
 
+// runListFunc runs the ListFunc of a metric and forwards what it sends to ch until ctx is done.
+// The ListFunc writes to its own channel so that it can be abandoned when the deadline
+// is reached, without writing to ch once Collect has returned.
+func (exporter *BaseOpenStackExporter) runListFunc(ctx context.Context, metric *PrometheusMetric, ch chan<- prometheus.Metric) error {
+	metrics := make(chan prometheus.Metric)
+	result := make(chan error, 1)
+	go func() {
+		result <- metric.Fn(ctx, exporter, metrics)
+		close(metrics)
+	}()
+
+	for {
+		select {
+		case m, ok := <-metrics:
+			if !ok {
+				return <-result
+			}
+			select {
+			case ch <- m:
+				continue
+			case <-ctx.Done():
+			}
+		case <-ctx.Done():
+		}
+
+		// Drain what the abandoned ListFunc still sends until it notices the cancellation.
+		go func() {
+			for range metrics {
+			}
+		}()
+		return ctx.Err()
+	}
+}
+
 func (exporter *BaseOpenStackExporter) Collect(ch chan<- prometheus.Metric) {
+	ctx := exporter.scrapeContext()
 	metricsCount := 0
 	var failures int32
 
@@ -149,7 +246,7 @@ func (exporter *BaseOpenStackExporter) Collect(ch chan<- prometheus.Metric) {
 		metric := metric
 
 		g.Go(func() error {
-			if err := exporter.RunCollection(metric, name, ch, exporter.logger); err != nil {
+			if err := exporter.RunCollection(ctx, metric, name, ch, exporter.logger); err != nil {
 				exporter.logger.Error(
 					"Failed to collect metric for exporter",
 					"exporter", exporter.Name,
@@ -170,8 +267,10 @@ func (exporter *BaseOpenStackExporter) Collect(ch chan<- prometheus.Metric) {
 	}
 
 	if int(atomic.LoadInt32(&failures)) >= metricsCount {
+		exporter.breaker.record(false, time.Now())
 		ch <- prometheus.MustNewConstMetric(exporter.Metrics["up"].Metric, prometheus.GaugeValue, 0)
 	} else {
+		exporter.breaker.record(true, time.Now())
 		ch <- prometheus.MustNewConstMetric(exporter.Metrics["up"].Metric, prometheus.GaugeValue, 1)
 	}
 }
@@ -207,6 +306,11 @@ func (exporter *BaseOpenStackExporter) AddMetric(name string, fn ListFunc, label
 				"openstack_metric_collect_seconds", "Time needed to collect metric from OpenStack API", []string{"openstack_metric"}, prometheus.Labels{"openstack_service": exporter.GetName()}),
 			Fn: nil,
 		}
+		exporter.Metrics["openstack_metric_collect_timeout"] = &PrometheusMetric{
+			Metric: prometheus.NewDesc(
+				"openstack_metric_collect_timeout", "Set to 1 when collecting the metric from OpenStack API was cancelled by its deadline", []string{"openstack_metric"}, prometheus.Labels{"openstack_service": exporter.GetName()}),
+			Fn: nil,
+		}
 	}
 
 	if constLabels == nil {
@@ -257,19 +361,12 @@ func pathOrContents(poc string) ([]byte, bool, error) {
 	return []byte(poc), false, nil
 }
 
-func NewExporter(name, prefix, cloud string, disabledMetrics []string, endpointType string, collectTime bool, disableSlowMetrics bool, disableDeprecatedMetrics bool, disableCinderAgentUUID bool, domainID string, tenantID string, novaMetadataMapping *utils.LabelMappingFlag, dnsConcurrentCount int, uuidGenFunc func() (string, error), logger *slog.Logger) (OpenStackExporter, error) {
-	var exporter OpenStackExporter
-	var err error
+// newTransport builds the HTTP transport for a cloud, honouring the TLS settings from clouds.yaml
+// and wrapping it with a debug logger when OS_DEBUG is set.
+func newTransport(config *clientconfigv2.Cloud, logger *slog.Logger) (http.RoundTripper, error) {
 	var transport http.RoundTripper
 	var tlsConfig tls.Config
 
-	optsv2 := clientconfigv2.ClientOpts{Cloud: cloud}
-
-	config, err := clientconfigv2.GetCloudFromYAML(&optsv2)
-	if err != nil {
-		return nil, err
-	}
-
 	var configureTransport = false
 	if !*config.Verify {
 		logger.Info("SSL verification disabled on transport")
@@ -317,8 +414,22 @@ func NewExporter(name, prefix, cloud string, disabledMetrics []string, endpointT
 		}
 	}
 
-	clientV2, err := NewServiceClientV2(name, &optsv2, transport, endpointType)
+	return transport, nil
+}
+
+func NewExporter(ctx context.Context, name, prefix, cloud string, disabledMetrics []string, endpointType string, collectTime bool, metricTimeout time.Duration, disableSlowMetrics bool, disableDeprecatedMetrics bool, disableCinderAgentUUID bool, domainID string, tenantID string, novaMetadataMapping *utils.LabelMappingFlag, dnsConcurrentCount int, uuidGenFunc func() (string, error), logger *slog.Logger) (OpenStackExporter, error) {
+	var exporter OpenStackExporter
+	var err error
+
+	breaker := GetCircuitBreakers().breaker(cloud, name)
+	if !breaker.allow(time.Now()) {
+		return nil, ErrCircuitOpen
+	}
+
+	pool := GetClientPool()
+	clientV2, err := pool.ServiceClient(ctx, name, cloud, endpointType, logger)
 	if err != nil {
+		breaker.recordEnableError(err, time.Now())
 		return nil, err
 	}
 
@@ -332,6 +443,7 @@ func NewExporter(name, prefix, cloud string, disabledMetrics []string, endpointT
 		Prefix:                   prefix,
 		DisabledMetrics:          disabledMetrics,
 		CollectTime:              collectTime,
+		MetricTimeout:            metricTimeout,
 		UUIDGenFunc:              uuidGenFunc,
 		DisableSlowMetrics:       disableSlowMetrics,
 		DisableDeprecatedMetrics: disableDeprecatedMetrics,
@@ -340,6 +452,9 @@ func NewExporter(name, prefix, cloud string, disabledMetrics []string, endpointT
 		TenantID:                 tenantID,
 		NovaMetadataMapping:      novaMetadataMapping,
 		DnsConcurrentCount:       dnsConcurrentCount,
+		ctx:                      ctx,
+		collectorMetrics:         GetCollectorMetrics(prefix, cloud),
+		breaker:                  breaker,
 	}
 
 	switch name {
@@ -373,13 +488,19 @@ func NewExporter(name, prefix, cloud string, disabledMetrics []string, endpointT
 		exporter, err = NewPlacementExporter(&exporterConfig, logger)
 	case "sharev2":
 		exporter, err = NewManilaExporter(&exporterConfig, logger)
+	case "instance-ha":
+		exporter, err = NewMasakariExporter(&exporterConfig, logger)
 	default:
 		return nil, fmt.Errorf("couldn't find a handler for %s exporter", name)
 	}
 
 	if err != nil {
+		breaker.recordEnableError(err, time.Now())
 		return nil, err
 	}
 
+	// Remember the negotiated microversion so the next exporter for this cloud skips discovery.
+	pool.SetMicroversion(name, cloud, endpointType, clientV2.Microversion)
+
 	return exporter, nil
 }
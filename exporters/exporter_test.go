@@ -1,17 +1,24 @@
 package exporters
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"path"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"log/slog"
 
 	"github.com/jarcoal/httpmock"
 	"github.com/openstack-exporter/openstack-exporter/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -36,8 +43,14 @@ func (suite *BaseOpenStackTestSuite) SetResponseFromFixture(method string, statu
 		StatusCode: statusCode,
 	}
 
+	// Metrics are collected concurrently and the call counter of Times is not goroutine safe.
+	var mu sync.Mutex
 	responder := httpmock.ResponderFromResponse(response).Times(2)
-	httpmock.RegisterResponder(method, url, responder)
+	httpmock.RegisterResponder(method, url, func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return responder(req)
+	})
 }
 
 func (suite *BaseOpenStackTestSuite) MakeURL(resource string, port string) string {
@@ -162,7 +175,10 @@ var fixtures map[string]string = map[string]string{
 	"/neutron/v2.0/quotas/5961c443439d4fcebe42643723755e9d/details.json":             "neutron_quotas_1_usage",
 	"/neutron/v2.0/quotas/fdb8424c4e4f4c0ba32c52e2de3bd80e/details.json":             "neutron_quotas_1_usage",
 	"/neutron/v2.0/quotas/4b1eb781a47440acb8af9850103e537f/details.json":             "neutron_quotas_1_usage",
-	"/shares/v2/shares/detail?all_tenants=true":                                      "manila_shares",
+	"/instance-ha/segments": "masakari_segments",
+	"/instance-ha/segments/9e800031-6946-4b43-bf09-8b3d1cab792b/hosts": "masakari_hosts",
+	"/instance-ha/notifications":                                       "masakari_notifications",
+	"/shares/v2/shares/detail?all_tenants=true":                        "manila_shares",
 	"/object-store/": "swift_list", // NOTE: /v1/AUTH_%(tenant_id)s
 	"/object-store/?marker=centos9-epel-next": "swift_empty",
 }
@@ -177,10 +193,11 @@ func (suite *BaseOpenStackTestSuite) SetupTest() {
 	suite.installFixtures()
 
 	os.Setenv("OS_CLIENT_CONFIG_FILE", path.Join(baseFixturePath, "test_config.yaml"))
+	GetClientPool().InvalidateAll()
 
 	novaMetadataMapping := new(utils.LabelMappingFlag)
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{}))
-	exporter, err := NewExporter(suite.ServiceName, suite.Prefix, cloudName, []string{}, "public", false, false, false, false, "", "", novaMetadataMapping, 10, func() (string, error) {
+	exporter, err := NewExporter(context.Background(), suite.ServiceName, suite.Prefix, cloudName, []string{}, "public", false, 0, false, false, false, "", "", novaMetadataMapping, 10, func() (string, error) {
 		return DEFAULT_UUID, nil
 	}, logger)
 
@@ -238,4 +255,48 @@ func TestOpenStackSuites(t *testing.T) {
 	suite.Run(t, &PlacementTestSuite{BaseOpenStackTestSuite: BaseOpenStackTestSuite{ServiceName: "placement"}})
 	suite.Run(t, &ManilaTestSuite{BaseOpenStackTestSuite: BaseOpenStackTestSuite{ServiceName: "sharev2"}})
 	suite.Run(t, &ObjectStoreTestSuite{BaseOpenStackTestSuite: BaseOpenStackTestSuite{ServiceName: "object-store"}})
+	suite.Run(t, &MasakariTestSuite{BaseOpenStackTestSuite: BaseOpenStackTestSuite{ServiceName: "instance-ha"}})
+}
+
+func TestCollectMetricTimeout(t *testing.T) {
+	exporter := BaseOpenStackExporter{
+		Name: "slow",
+		ExporterConfig: ExporterConfig{
+			Prefix:        "openstack",
+			MetricTimeout: 50 * time.Millisecond,
+		},
+		logger: slog.New(slog.DiscardHandler),
+	}
+	exporter.AddMetric("fast", func(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+		ch <- prometheus.MustNewConstMetric(exporter.Metrics["fast"].Metric, prometheus.GaugeValue, 1)
+		return nil
+	}, nil, "", nil)
+	// The slow ListFunc ignores the cancellation and keeps sending after the deadline.
+	released := make(chan struct{})
+	exporter.AddMetric("slow", func(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+		<-ctx.Done()
+		ch <- prometheus.MustNewConstMetric(exporter.Metrics["slow"].Metric, prometheus.GaugeValue, 1)
+		close(released)
+		return ctx.Err()
+	}, nil, "", nil)
+
+	expected := `
+# HELP openstack_metric_collect_timeout Set to 1 when collecting the metric from OpenStack API was cancelled by its deadline
+# TYPE openstack_metric_collect_timeout gauge
+openstack_metric_collect_timeout{openstack_metric="slow",openstack_service="openstack_slow"} 1
+# HELP openstack_slow_fast fast
+# TYPE openstack_slow_fast gauge
+openstack_slow_fast 1
+# HELP openstack_slow_up up
+# TYPE openstack_slow_up gauge
+openstack_slow_up 1
+`
+	err := testutil.CollectAndCompare(&exporter, strings.NewReader(expected))
+	require.NoError(t, err)
+
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("the abandoned ListFunc is still blocked on its channel")
+	}
 }
@@ -22,7 +22,7 @@ var defaultGlanceMetrics = []Metric{
 func NewGlanceExporter(config *ExporterConfig, logger *slog.Logger) (*GlanceExporter, error) {
 	exporter := GlanceExporter{
 		BaseOpenStackExporter{
-			Name:           "glance",
+			Name:           exporterNames["image"],
 			ExporterConfig: *config,
 			logger:         logger,
 		},
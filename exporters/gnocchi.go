@@ -23,7 +23,7 @@ var defaultGnocchiMetrics = []Metric{
 func NewGnocchiExporter(config *ExporterConfig, logger *slog.Logger) (*GnocchiExporter, error) {
 	exporter := GnocchiExporter{
 		BaseOpenStackExporter{
-			Name:           "gnocchi",
+			Name:           exporterNames["gnocchi"],
 			ExporterConfig: *config,
 			logger:         logger,
 		},
@@ -75,7 +75,7 @@ var defaultHeatMetrics = []Metric{
 func NewHeatExporter(config *ExporterConfig, logger *slog.Logger) (*HeatExporter, error) {
 	exporter := HeatExporter{
 		BaseOpenStackExporter{
-			Name:           "heat",
+			Name:           exporterNames["orchestration"],
 			ExporterConfig: *config,
 			logger:         logger,
 		},
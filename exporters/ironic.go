@@ -26,21 +26,24 @@ var defaultIronicMetrics = []Metric{
 
 // NewIronicExporter : returns a pointer to IronicExporter
 func NewIronicExporter(config *ExporterConfig, logger *slog.Logger) (*IronicExporter, error) {
-	ctx := context.TODO()
+	ctx := config.scrapeContext()
 
 	// NOTE(Sharpz7) Gophercloud V2 adds this new field ResourceBase.
 	// For whatever reason, it adds a v1 field to the URL,
 	// so it sends requests to /v1/v1 if left unfixed.
 	//config.ClientV2.ResourceBase = config.ClientV2.Endpoint
 
-	err := utils.SetupClientMicroversionV2(ctx, config.ClientV2, "OS_BAREMETAL_API_VERSION", ironicLatestSupportedMicroversion, logger)
-	if err != nil {
-		return nil, err
+	// The microversion is already known when the client comes from the ClientPool.
+	if config.ClientV2.Microversion == "" {
+		err := utils.SetupClientMicroversionV2(ctx, config.ClientV2, "OS_BAREMETAL_API_VERSION", ironicLatestSupportedMicroversion, logger)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	exporter := IronicExporter{
 		BaseOpenStackExporter{
-			Name:           "ironic",
+			Name:           exporterNames["baremetal"],
 			ExporterConfig: *config,
 			logger:         logger,
 		},
@@ -33,7 +33,7 @@ var defaultKeystoneMetrics = []Metric{
 func NewKeystoneExporter(config *ExporterConfig, logger *slog.Logger) (*KeystoneExporter, error) {
 	exporter := KeystoneExporter{
 		BaseOpenStackExporter{
-			Name:           "identity",
+			Name:           exporterNames["identity"],
 			ExporterConfig: *config,
 			logger:         logger,
 		},
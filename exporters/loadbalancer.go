@@ -71,7 +71,7 @@ var defaultLoadbalancerMetrics = []Metric{
 func NewLoadbalancerExporter(config *ExporterConfig, logger *slog.Logger) (*LoadbalancerExporter, error) {
 	exporter := LoadbalancerExporter{
 		BaseOpenStackExporter{
-			Name:           "loadbalancer",
+			Name:           exporterNames["load-balancer"],
 			ExporterConfig: *config,
 			logger:         logger,
 		},
@@ -0,0 +1,204 @@
+package exporters
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/pagination"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Masakari notification statuses, see
+// https://docs.openstack.org/api-ref/instance-ha/#list-notifications
+var knownNotificationStatuses = map[string]int{
+	"new":      0, // The notification has been received and not processed yet.
+	"running":  1, // The notification is being processed by the engine.
+	"error":    2, // The recovery workflow failed, the engine will retry it.
+	"failed":   3, // The recovery workflow failed and will not be retried.
+	"ignored":  4, // The notification has been ignored, e.g. host already on maintenance.
+	"finished": 5, // The recovery workflow completed successfully.
+}
+
+func mapNotificationStatus(current string) int {
+	return mapStatus(knownNotificationStatuses, current)
+}
+
+type MasakariExporter struct {
+	BaseOpenStackExporter
+}
+
+type masakariSegment struct {
+	ID             int    `json:"id"`
+	UUID           string `json:"uuid"`
+	Name           string `json:"name"`
+	ServiceType    string `json:"service_type"`
+	RecoveryMethod string `json:"recovery_method"`
+}
+
+type masakariHost struct {
+	ID                int    `json:"id"`
+	UUID              string `json:"uuid"`
+	Name              string `json:"name"`
+	Type              string `json:"type"`
+	ControlAttributes string `json:"control_attributes"`
+	Reserved          bool   `json:"reserved"`
+	OnMaintenance     bool   `json:"on_maintenance"`
+	FailoverSegmentID string `json:"failover_segment_id"`
+}
+
+type masakariNotification struct {
+	NotificationUUID string `json:"notification_uuid"`
+	Type             string `json:"type"`
+	Status           string `json:"status"`
+	SourceHostUUID   string `json:"source_host_uuid"`
+}
+
+// masakariPage is a page of a Masakari collection. Masakari returns the next
+// page marker in a "<resource>_links" element, the same way Nova does.
+type masakariPage struct {
+	pagination.LinkedPageBase
+	resource string
+}
+
+func (r masakariPage) NextPageURL() (string, error) {
+	var links []gophercloud.Link
+	if err := r.ExtractIntoSlicePtr(&links, r.resource+"_links"); err != nil {
+		return "", err
+	}
+	return gophercloud.ExtractNextURL(links)
+}
+
+func (r masakariPage) IsEmpty() (bool, error) {
+	var items []any
+	if err := r.ExtractIntoSlicePtr(&items, r.resource); err != nil {
+		return false, err
+	}
+	return len(items) == 0, nil
+}
+
+func listMasakari(client *gophercloud.ServiceClient, resource string, url string) pagination.Pager {
+	return pagination.NewPager(client, url, func(r pagination.PageResult) pagination.Page {
+		return masakariPage{LinkedPageBase: pagination.LinkedPageBase{PageResult: r}, resource: resource}
+	})
+}
+
+// extractMasakari extracts the given resource collection from all pages of a Masakari listing.
+func extractMasakari(ctx context.Context, pager pagination.Pager, resource string, v any) error {
+	allPages, err := pager.AllPages(ctx)
+	if err != nil {
+		return err
+	}
+	return (allPages.(masakariPage)).ExtractIntoSlicePtr(v, resource)
+}
+
+var defaultMasakariMetrics = []Metric{
+	{Name: "total_segments", Fn: ListSegmentsAndHosts},
+	{Name: "segment", Labels: []string{"id", "uuid", "name", "service_type", "recovery_method"}},
+	{Name: "total_hosts", Labels: []string{"failover_segment_id", "failover_segment_name"}},
+	{Name: "host", Labels: []string{"id", "uuid", "hostname", "failover_segment_id", "failover_segment_name", "type", "control_attributes"}},
+	{Name: "host_on_maintenance", Labels: []string{"uuid", "hostname", "failover_segment_id", "failover_segment_name"}},
+	{Name: "host_reserved", Labels: []string{"uuid", "hostname", "failover_segment_id", "failover_segment_name"}},
+	{Name: "total_notifications", Fn: ListNotifications},
+	{Name: "notification_status_counter", Labels: []string{"status"}},
+}
+
+func NewMasakariExporter(config *ExporterConfig, logger *slog.Logger) (*MasakariExporter, error) {
+	exporter := MasakariExporter{
+		BaseOpenStackExporter{
+			Name:           exporterNames["instance-ha"],
+			ExporterConfig: *config,
+			logger:         logger,
+		},
+	}
+
+	for _, metric := range defaultMasakariMetrics {
+		if exporter.isDeprecatedMetric(&metric) {
+			continue
+		}
+		if !exporter.isSlowMetric(&metric) {
+			exporter.AddMetric(metric.Name, metric.Fn, metric.Labels, metric.DeprecatedVersion, nil)
+		}
+	}
+
+	return &exporter, nil
+}
+
+// ListSegmentsAndHosts : list failover segments and the hosts of each segment
+func ListSegmentsAndHosts(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+	client := exporter.ClientV2
+
+	var allSegments []masakariSegment
+	err := extractMasakari(ctx, listMasakari(client, "segments", client.ServiceURL("segments")), "segments", &allSegments)
+	if err != nil {
+		return err
+	}
+
+	ch <- prometheus.MustNewConstMetric(exporter.Metrics["total_segments"].Metric,
+		prometheus.GaugeValue, float64(len(allSegments)))
+
+	for _, segment := range allSegments {
+		ch <- prometheus.MustNewConstMetric(exporter.Metrics["segment"].Metric,
+			prometheus.GaugeValue, 1.0, strconv.Itoa(segment.ID), segment.UUID, segment.Name,
+			segment.ServiceType, segment.RecoveryMethod)
+
+		var allHosts []masakariHost
+		err := extractMasakari(ctx, listMasakari(client, "hosts", client.ServiceURL("segments", segment.UUID, "hosts")), "hosts", &allHosts)
+		if err != nil {
+			return err
+		}
+
+		ch <- prometheus.MustNewConstMetric(exporter.Metrics["total_hosts"].Metric,
+			prometheus.GaugeValue, float64(len(allHosts)), segment.UUID, segment.Name)
+
+		for _, host := range allHosts {
+			ch <- prometheus.MustNewConstMetric(exporter.Metrics["host"].Metric,
+				prometheus.GaugeValue, 1.0, strconv.Itoa(host.ID), host.UUID, host.Name,
+				host.FailoverSegmentID, segment.Name, host.Type, host.ControlAttributes)
+
+			ch <- prometheus.MustNewConstMetric(exporter.Metrics["host_on_maintenance"].Metric,
+				prometheus.GaugeValue, boolToFloat(host.OnMaintenance), host.UUID, host.Name,
+				host.FailoverSegmentID, segment.Name)
+
+			ch <- prometheus.MustNewConstMetric(exporter.Metrics["host_reserved"].Metric,
+				prometheus.GaugeValue, boolToFloat(host.Reserved), host.UUID, host.Name,
+				host.FailoverSegmentID, segment.Name)
+		}
+	}
+
+	return nil
+}
+
+// ListNotifications : count notifications by status
+func ListNotifications(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+	client := exporter.ClientV2
+
+	var allNotifications []masakariNotification
+	err := extractMasakari(ctx, listMasakari(client, "notifications", client.ServiceURL("notifications")), "notifications", &allNotifications)
+	if err != nil {
+		return err
+	}
+
+	ch <- prometheus.MustNewConstMetric(exporter.Metrics["total_notifications"].Metric,
+		prometheus.GaugeValue, float64(len(allNotifications)))
+
+	notificationStatusCounter := make(map[string]int, len(knownNotificationStatuses))
+	for status := range knownNotificationStatuses {
+		notificationStatusCounter[status] = 0
+	}
+
+	for _, notification := range allNotifications {
+		if mapNotificationStatus(notification.Status) == -1 {
+			exporter.logger.Debug("unknown masakari notification status", "status", notification.Status, "notification_uuid", notification.NotificationUUID)
+		}
+		notificationStatusCounter[notification.Status]++
+	}
+
+	for status, count := range notificationStatusCounter {
+		ch <- prometheus.MustNewConstMetric(exporter.Metrics["notification_status_counter"].Metric,
+			prometheus.GaugeValue, float64(count), status)
+	}
+
+	return nil
+}
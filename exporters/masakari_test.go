@@ -0,0 +1,55 @@
+package exporters
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type MasakariTestSuite struct {
+	BaseOpenStackTestSuite
+}
+
+var masakariExpectedUp = `
+# HELP openstack_masakari_host host
+# TYPE openstack_masakari_host gauge
+openstack_masakari_host{control_attributes="SSH",failover_segment_id="9e800031-6946-4b43-bf09-8b3d1cab792b",failover_segment_name="segment1",hostname="compute-1",id="1",type="COMPUTE",uuid="083a8474-22c0-407f-b89b-c569134c3bfd"} 1
+openstack_masakari_host{control_attributes="SSH",failover_segment_id="9e800031-6946-4b43-bf09-8b3d1cab792b",failover_segment_name="segment1",hostname="compute-2",id="2",type="COMPUTE",uuid="2d9ba1b4-0a47-4d49-8bba-3a4e5f2fc6b9"} 1
+# HELP openstack_masakari_host_on_maintenance host_on_maintenance
+# TYPE openstack_masakari_host_on_maintenance gauge
+openstack_masakari_host_on_maintenance{failover_segment_id="9e800031-6946-4b43-bf09-8b3d1cab792b",failover_segment_name="segment1",hostname="compute-1",uuid="083a8474-22c0-407f-b89b-c569134c3bfd"} 0
+openstack_masakari_host_on_maintenance{failover_segment_id="9e800031-6946-4b43-bf09-8b3d1cab792b",failover_segment_name="segment1",hostname="compute-2",uuid="2d9ba1b4-0a47-4d49-8bba-3a4e5f2fc6b9"} 1
+# HELP openstack_masakari_host_reserved host_reserved
+# TYPE openstack_masakari_host_reserved gauge
+openstack_masakari_host_reserved{failover_segment_id="9e800031-6946-4b43-bf09-8b3d1cab792b",failover_segment_name="segment1",hostname="compute-1",uuid="083a8474-22c0-407f-b89b-c569134c3bfd"} 0
+openstack_masakari_host_reserved{failover_segment_id="9e800031-6946-4b43-bf09-8b3d1cab792b",failover_segment_name="segment1",hostname="compute-2",uuid="2d9ba1b4-0a47-4d49-8bba-3a4e5f2fc6b9"} 1
+# HELP openstack_masakari_notification_status_counter notification_status_counter
+# TYPE openstack_masakari_notification_status_counter gauge
+openstack_masakari_notification_status_counter{status="error"} 0
+openstack_masakari_notification_status_counter{status="failed"} 1
+openstack_masakari_notification_status_counter{status="finished"} 1
+openstack_masakari_notification_status_counter{status="ignored"} 0
+openstack_masakari_notification_status_counter{status="new"} 0
+openstack_masakari_notification_status_counter{status="running"} 1
+# HELP openstack_masakari_segment segment
+# TYPE openstack_masakari_segment gauge
+openstack_masakari_segment{id="1",name="segment1",recovery_method="auto",service_type="COMPUTE",uuid="9e800031-6946-4b43-bf09-8b3d1cab792b"} 1
+# HELP openstack_masakari_total_hosts total_hosts
+# TYPE openstack_masakari_total_hosts gauge
+openstack_masakari_total_hosts{failover_segment_id="9e800031-6946-4b43-bf09-8b3d1cab792b",failover_segment_name="segment1"} 2
+# HELP openstack_masakari_total_notifications total_notifications
+# TYPE openstack_masakari_total_notifications gauge
+openstack_masakari_total_notifications 3
+# HELP openstack_masakari_total_segments total_segments
+# TYPE openstack_masakari_total_segments gauge
+openstack_masakari_total_segments 1
+# HELP openstack_masakari_up up
+# TYPE openstack_masakari_up gauge
+openstack_masakari_up 1
+`
+
+func (suite *MasakariTestSuite) TestMasakariExporter() {
+	err := testutil.CollectAndCompare(*suite.Exporter, strings.NewReader(masakariExpectedUp))
+	assert.NoError(suite.T(), err)
+}
@@ -141,7 +141,7 @@ var defaultNeutronMetrics = []Metric{
 func NewNeutronExporter(config *ExporterConfig, logger *slog.Logger) (*NeutronExporter, error) {
 	exporter := NeutronExporter{
 		BaseOpenStackExporter{
-			Name:           "neutron",
+			Name:           exporterNames["network"],
 			ExporterConfig: *config,
 			logger:         logger,
 		},
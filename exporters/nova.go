@@ -110,16 +110,19 @@ var defaultNovaMetrics = []Metric{
 }
 
 func NewNovaExporter(config *ExporterConfig, logger *slog.Logger) (*NovaExporter, error) {
-	ctx := context.TODO()
+	ctx := config.scrapeContext()
 
-	err := utils.SetupClientMicroversionV2(ctx, config.ClientV2, "OS_COMPUTE_API_VERSION", novaLatestSupportedMicroversion, logger)
-	if err != nil {
-		return nil, err
+	// The microversion is already known when the client comes from the ClientPool.
+	if config.ClientV2.Microversion == "" {
+		err := utils.SetupClientMicroversionV2(ctx, config.ClientV2, "OS_COMPUTE_API_VERSION", novaLatestSupportedMicroversion, logger)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	exporter := NovaExporter{
 		BaseOpenStackExporter{
-			Name:           "nova",
+			Name:           exporterNames["compute"],
 			ExporterConfig: *config,
 			logger:         logger,
 		},
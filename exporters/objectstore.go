@@ -21,7 +21,7 @@ var defaultObjectStoreMetrics = []Metric{
 func NewObjectStoreExporter(config *ExporterConfig, logger *slog.Logger) (*ObjectStoreExporter, error) {
 	exporter := ObjectStoreExporter{
 		BaseOpenStackExporter{
-			Name:           "object_store",
+			Name:           exporterNames["object-store"],
 			ExporterConfig: *config,
 			logger:         logger,
 		},
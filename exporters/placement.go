@@ -27,7 +27,7 @@ var defaultPlacementMetrics = []Metric{
 func NewPlacementExporter(config *ExporterConfig, logger *slog.Logger) (*PlacementExporter, error) {
 	exporter := PlacementExporter{
 		BaseOpenStackExporter{
-			Name:           "placement",
+			Name:           exporterNames["placement"],
 			ExporterConfig: *config,
 			logger:         logger,
 		},
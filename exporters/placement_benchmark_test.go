@@ -131,7 +131,7 @@ func BenchmarkPlacementCacheWrite10000(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		response := httptest.NewRecorder()
-		if err := cache.WriteCacheToResponse(response, request, placementBenchmarkCloud, []string{placementBenchmarkService}, logger); err != nil {
+		if err := cache.WriteCacheToResponse(response, request, placementBenchmarkCloud, []string{placementBenchmarkService}, nil, false, logger); err != nil {
 			b.Fatalf("cache write failed: %v", err)
 		}
 		if response.Code != http.StatusOK {
@@ -0,0 +1,109 @@
+package exporters
+
+import (
+	"io"
+	"net/http"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
+)
+
+// RateLimits bound the requests made to the API of every service of a cloud, so that the exporters
+// making one call per project or resource provider do not trip the rate limits of the cloud.
+type RateLimits struct {
+	// Rate is the number of requests per second, unlimited when 0.
+	Rate float64
+	// Burst is the number of requests which can be made at once before Rate applies, at least 1.
+	Burst int
+	// MaxInFlight is the number of requests running at the same time, unlimited when 0.
+	MaxInFlight int
+}
+
+func (l RateLimits) enabled() bool {
+	return l.Rate > 0 || l.MaxInFlight > 0
+}
+
+// limitTransport is an http.RoundTripper applying the RateLimits to the requests of a cloud, by service.
+// The requests wait for their turn until their context is done.
+type limitTransport struct {
+	next      http.RoundTripper
+	limits    RateLimits
+	endpoints *serviceEndpoints
+
+	mu       sync.Mutex
+	limiters map[string]*serviceLimiter
+}
+
+// serviceLimiter limits the requests to the API of a service, its fields are nil when unlimited.
+type serviceLimiter struct {
+	rate     *rate.Limiter
+	inFlight *semaphore.Weighted
+}
+
+func newLimitTransport(next http.RoundTripper, limits RateLimits, endpoints *serviceEndpoints) *limitTransport {
+	return &limitTransport{
+		next:      withProxy(next),
+		limits:    limits,
+		endpoints: endpoints,
+		limiters:  make(map[string]*serviceLimiter),
+	}
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	limiter := t.limiter(t.endpoints.service(req))
+
+	// The request waits for its token before taking a slot, so that the slots are not held while waiting.
+	if limiter.rate != nil {
+		if err := limiter.rate.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	if limiter.inFlight == nil {
+		return t.next.RoundTrip(req)
+	}
+	if err := limiter.inFlight.Acquire(req.Context(), 1); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		limiter.inFlight.Release(1)
+		return nil, err
+	}
+	// The request is in flight until its response is read.
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: sync.OnceFunc(func() { limiter.inFlight.Release(1) })}
+
+	return resp, nil
+}
+
+// limiter returns the serviceLimiter of service, creating it on first use.
+func (t *limitTransport) limiter(service string) *serviceLimiter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	limiter, ok := t.limiters[service]
+	if !ok {
+		limiter = &serviceLimiter{}
+		if t.limits.Rate > 0 {
+			limiter.rate = rate.NewLimiter(rate.Limit(t.limits.Rate), max(t.limits.Burst, 1))
+		}
+		if t.limits.MaxInFlight > 0 {
+			limiter.inFlight = semaphore.NewWeighted(int64(t.limits.MaxInFlight))
+		}
+		t.limiters[service] = limiter
+	}
+
+	return limiter
+}
+
+// releaseBody calls release when the response body is closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,94 @@
+package exporters
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingTransport answers the requests once released, and records how many ran at the same time.
+type blockingTransport struct {
+	release  chan struct{}
+	inFlight atomic.Int32
+	peak     atomic.Int32
+}
+
+func (t *blockingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	n := t.inFlight.Add(1)
+	for {
+		peak := t.peak.Load()
+		if n <= peak || t.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	<-t.release
+	t.inFlight.Add(-1)
+
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+}
+
+func newLimitTestEndpoints() *serviceEndpoints {
+	endpoints := newServiceEndpoints()
+	endpoints.add("http://test.cloud/compute/", "compute")
+	endpoints.add("http://test.cloud/volume/", "volume")
+	return endpoints
+}
+
+func doRequest(t *testing.T, transport http.RoundTripper, ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	require.NoError(t, err)
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+func TestLimitTransportMaxInFlight(t *testing.T) {
+	next := &blockingTransport{release: make(chan struct{})}
+	transport := newLimitTransport(next, RateLimits{MaxInFlight: 2}, newLimitTestEndpoints())
+
+	var wg sync.WaitGroup
+	for range 6 {
+		wg.Go(func() {
+			assert.NoError(t, doRequest(t, transport, context.Background(), "http://test.cloud/compute/v2.1/os-quota-sets/1"))
+		})
+	}
+	// The requests to another service are not held back by the ones to compute.
+	wg.Go(func() {
+		assert.NoError(t, doRequest(t, transport, context.Background(), "http://test.cloud/volume/v3/limits"))
+	})
+
+	require.Eventually(t, func() bool { return next.inFlight.Load() == 3 }, time.Second, time.Millisecond)
+	close(next.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(3), next.peak.Load())
+}
+
+func TestLimitTransportRate(t *testing.T) {
+	next := &blockingTransport{release: make(chan struct{})}
+	close(next.release)
+	transport := newLimitTransport(next, RateLimits{Rate: 1, Burst: 2}, newLimitTestEndpoints())
+
+	require.NoError(t, doRequest(t, transport, context.Background(), "http://test.cloud/compute/v2.1/limits"))
+	require.NoError(t, doRequest(t, transport, context.Background(), "http://test.cloud/compute/v2.1/limits"))
+
+	// The burst is used up, the next request cannot get a token before its deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Error(t, doRequest(t, transport, ctx, "http://test.cloud/compute/v2.1/limits"))
+
+	// The other services have their own limiter.
+	require.NoError(t, doRequest(t, transport, ctx, "http://test.cloud/volume/v3/limits"))
+}
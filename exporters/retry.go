@@ -0,0 +1,130 @@
+package exporters
+
+import (
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Reasons a request is retried, in addition to collectErrorHTTP5xx.
+const (
+	retryReasonHTTP429         = "http_429"
+	retryReasonConnectionReset = "connection_reset"
+)
+
+// retryMaxDelay is the longest delay a request waits for before being retried, a longer Retry-After is not honoured
+// and the response returned as is.
+const retryMaxDelay = 30 * time.Second
+
+// Retries configure how the GET requests failing transiently are retried.
+type Retries struct {
+	// Max is the number of retries of a request, none when 0.
+	Max int
+	// Backoff is the delay before the first retry, doubled on every retry.
+	Backoff time.Duration
+}
+
+// retryTransport is an http.RoundTripper retrying the GET requests of a cloud getting a 5xx or 429 response,
+// or whose connection was reset. The retries stop at the deadline of the request.
+type retryTransport struct {
+	next      http.RoundTripper
+	retries   Retries
+	metrics   *APIMetrics
+	endpoints *serviceEndpoints
+}
+
+// newRetryTransport returns a retryTransport sending the requests with next, metrics counts the retries when set.
+func newRetryTransport(next http.RoundTripper, retries Retries, metrics *APIMetrics, endpoints *serviceEndpoints) *retryTransport {
+	return &retryTransport{
+		next:      withProxy(next),
+		retries:   retries,
+		metrics:   metrics,
+		endpoints: endpoints,
+	}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Only the requests without a body can be sent again as is.
+	if req.Method != http.MethodGet || req.Body != nil && req.Body != http.NoBody {
+		return t.next.RoundTrip(req)
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if attempt == t.retries.Max {
+			return resp, err
+		}
+		reason, retry := retryReason(resp, err)
+		if !retry {
+			return resp, err
+		}
+
+		delay, ok := retryDelay(resp, t.retries.Backoff, attempt)
+		if deadline, set := req.Context().Deadline(); !ok || set && time.Now().Add(delay).After(deadline) {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if t.metrics != nil {
+			t.metrics.retry(t.endpoints.service(req), reason)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// retryReason returns why a request should be retried given its outcome, false when it should not.
+func retryReason(resp *http.Response, err error) (string, bool) {
+	switch {
+	case err != nil:
+		return retryReasonConnectionReset, errors.Is(err, syscall.ECONNRESET)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return retryReasonHTTP429, true
+	case resp.StatusCode >= 500:
+		return collectErrorHTTP5xx, true
+	}
+
+	return "", false
+}
+
+// retryDelay returns the delay before retrying a request, the Retry-After of its response when set, or else
+// backoff doubled on every attempt with a ±20% jitter. It returns false when the delay is too long.
+func retryDelay(resp *http.Response, backoff time.Duration, attempt int) (time.Duration, bool) {
+	if resp != nil {
+		if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return delay, delay <= retryMaxDelay
+		}
+	}
+
+	delay := backoff << min(attempt, 16)
+	delay += time.Duration((rand.Float64()*0.4 - 0.2) * float64(delay))
+
+	return min(delay, retryMaxDelay), true
+}
+
+// parseRetryAfter parses the Retry-After header, given either as seconds or as an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,148 @@
+package exporters
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sequenceTransport answers the requests with the responses of its sequence, the last one being repeated.
+type sequenceTransport struct {
+	responses []func() (*http.Response, error)
+	requests  int
+}
+
+func (t *sequenceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	respond := t.responses[min(t.requests, len(t.responses)-1)]
+	t.requests++
+	return respond()
+}
+
+func statusResponse(code int, header http.Header) func() (*http.Response, error) {
+	return func() (*http.Response, error) {
+		return &http.Response{StatusCode: code, Header: header, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+	}
+}
+
+func errorResponse(err error) func() (*http.Response, error) {
+	return func() (*http.Response, error) {
+		return nil, err
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		responses []func() (*http.Response, error)
+		code      int
+		requests  int
+		retries   map[string]float64
+	}{
+		{
+			name:   "transient failures",
+			method: http.MethodGet,
+			responses: []func() (*http.Response, error){
+				statusResponse(http.StatusBadGateway, nil),
+				statusResponse(http.StatusTooManyRequests, http.Header{"Retry-After": {"0"}}),
+				errorResponse(fmt.Errorf("read: %w", syscall.ECONNRESET)),
+				statusResponse(http.StatusOK, nil),
+			},
+			code:     http.StatusOK,
+			requests: 4,
+			retries:  map[string]float64{"http_5xx": 1, "http_429": 1, "connection_reset": 1},
+		},
+		{
+			name:      "retries exhausted",
+			method:    http.MethodGet,
+			responses: []func() (*http.Response, error){statusResponse(http.StatusServiceUnavailable, nil)},
+			code:      http.StatusServiceUnavailable,
+			requests:  4,
+			retries:   map[string]float64{"http_5xx": 3},
+		},
+		{
+			name:      "client error",
+			method:    http.MethodGet,
+			responses: []func() (*http.Response, error){statusResponse(http.StatusNotFound, nil)},
+			code:      http.StatusNotFound,
+			requests:  1,
+		},
+		{
+			name:      "not idempotent",
+			method:    http.MethodPost,
+			responses: []func() (*http.Response, error){statusResponse(http.StatusServiceUnavailable, nil)},
+			code:      http.StatusServiceUnavailable,
+			requests:  1,
+		},
+		{
+			name:      "Retry-After too long",
+			method:    http.MethodGet,
+			responses: []func() (*http.Response, error){statusResponse(http.StatusTooManyRequests, http.Header{"Retry-After": {"3600"}})},
+			code:      http.StatusTooManyRequests,
+			requests:  1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			next := &sequenceTransport{responses: test.responses}
+			metrics := NewAPIMetrics("retry_test", cloudName)
+			transport := newRetryTransport(next, Retries{Max: 3, Backoff: time.Millisecond}, metrics, newLimitTestEndpoints())
+
+			req, err := http.NewRequest(test.method, "http://test.cloud/compute/v2.1/servers/detail", nil)
+			require.NoError(t, err)
+			resp, err := transport.RoundTrip(req)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.code, resp.StatusCode)
+			assert.Equal(t, test.requests, next.requests)
+			assert.Equal(t, len(test.retries), testutil.CollectAndCount(metrics.retries))
+			for reason, count := range test.retries {
+				assert.Equal(t, count, testutil.ToFloat64(metrics.retries.WithLabelValues("compute", reason)), "reason: %s", reason)
+			}
+		})
+	}
+}
+
+func TestRetryTransportDeadline(t *testing.T) {
+	next := &sequenceTransport{responses: []func() (*http.Response, error){statusResponse(http.StatusServiceUnavailable, nil)}}
+	transport := newRetryTransport(next, Retries{Max: 10, Backoff: 20 * time.Millisecond}, nil, newLimitTestEndpoints())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://test.cloud/compute/v2.1/servers/detail", nil)
+	require.NoError(t, err)
+
+	start := time.Now()
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+
+	// The last response is returned when the next retry would be after the deadline.
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Less(t, next.requests, 10)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	delay, ok := parseRetryAfter("120")
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, delay)
+
+	delay, ok = parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.InDelta(t, time.Minute, delay, float64(2*time.Second))
+
+	_, ok = parseRetryAfter("")
+	assert.False(t, ok)
+	_, ok = parseRetryAfter("soon")
+	assert.False(t, ok)
+}
@@ -0,0 +1,158 @@
+package exporters
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	gophercloudv2 "github.com/gophercloud/gophercloud/v2"
+	openstackv2 "github.com/gophercloud/gophercloud/v2/openstack"
+	tokens2 "github.com/gophercloud/gophercloud/v2/openstack/identity/v2/tokens"
+	tokens3 "github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
+)
+
+// DefaultServiceAutodetectInterval is how long the services detected for a cloud are reused.
+const DefaultServiceAutodetectInterval = 1 * time.Hour
+
+var singleServiceAutodetector *ServiceAutodetector
+var serviceAutodetectorOnce sync.Once
+
+// ServiceAutodetector detects the services of each cloud from its Keystone catalog.
+// A cloud is detected on first use and again once the interval has passed, using the
+// pooled provider client so that no extra authentication is needed. The catalog is fetched
+// from Keystone on every detection, so that the services added or removed since are seen.
+type ServiceAutodetector struct {
+	mu       sync.Mutex
+	pool     *ClientPool
+	interval time.Duration
+	clouds   map[clientPoolKey]*detectedServices
+}
+
+// detectedServices are the services found in the catalog of a single cloud and endpoint type.
+type detectedServices struct {
+	mu         sync.Mutex
+	services   []string
+	detectedAt time.Time
+}
+
+// GetServiceAutodetector returns the singleton ServiceAutodetector, using the singleton ClientPool.
+func GetServiceAutodetector() *ServiceAutodetector {
+	serviceAutodetectorOnce.Do(
+		func() {
+			singleServiceAutodetector = NewServiceAutodetector(GetClientPool(), DefaultServiceAutodetectInterval)
+		},
+	)
+
+	return singleServiceAutodetector
+}
+
+// NewServiceAutodetector returns a ServiceAutodetector detecting the services with the clients of pool.
+func NewServiceAutodetector(pool *ClientPool, interval time.Duration) *ServiceAutodetector {
+	return &ServiceAutodetector{
+		pool:     pool,
+		interval: interval,
+		clouds:   make(map[clientPoolKey]*detectedServices),
+	}
+}
+
+// SetInterval changes how long the detected services are reused.
+func (d *ServiceAutodetector) SetInterval(interval time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.interval = interval
+}
+
+// Services returns the services found in the catalog of the given cloud.
+// When detecting again fails, the services detected before are returned.
+func (d *ServiceAutodetector) Services(ctx context.Context, cloud, endpointType string, logger *slog.Logger) ([]string, error) {
+	d.mu.Lock()
+	key := clientPoolKey{cloud, endpointType}
+	ds, ok := d.clouds[key]
+	if !ok {
+		ds = &detectedServices{}
+		d.clouds[key] = ds
+	}
+	interval := d.interval
+	d.mu.Unlock()
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if ds.services != nil && time.Since(ds.detectedAt) < interval {
+		return ds.services, nil
+	}
+
+	services, err := d.detect(ctx, cloud, endpointType, logger)
+	if err != nil {
+		if ds.services != nil {
+			logger.Warn("Failed to autodetect services, keeping the previously detected ones", "cloud", cloud, "error", err)
+			return ds.services, nil
+		}
+		return nil, err
+	}
+
+	logger.Debug("Autodetected services", "cloud", cloud, "services", services)
+	ds.services = services
+	ds.detectedAt = time.Now()
+
+	return services, nil
+}
+
+// Invalidate drops the detected services of the given cloud, for all endpoint types.
+func (d *ServiceAutodetector) Invalidate(cloud string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key := range d.clouds {
+		if key.cloud == cloud {
+			delete(d.clouds, key)
+		}
+	}
+}
+
+// InvalidateAll drops the detected services of every cloud.
+func (d *ServiceAutodetector) InvalidateAll() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.clouds = make(map[clientPoolKey]*detectedServices)
+}
+
+func (d *ServiceAutodetector) detect(ctx context.Context, cloud, endpointType string, logger *slog.Logger) ([]string, error) {
+	providerClient, endpointOpts, err := d.pool.ProviderClient(ctx, cloud, endpointType, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	locate, err := currentCatalog(ctx, providerClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return servicesFromCatalog(locate, endpointOpts)
+}
+
+// currentCatalog returns a locator of the endpoints of the current catalog of the cloud, fetched with the token
+// of providerClient: its EndpointLocator keeps the catalog of the authentication. Keystone v2 has no such request,
+// the catalog of the authentication is used.
+func currentCatalog(ctx context.Context, providerClient *gophercloudv2.ProviderClient) (gophercloudv2.EndpointLocator, error) {
+	if _, ok := providerClient.GetAuthResult().(tokens2.CreateResult); ok {
+		return providerClient.EndpointLocator, nil
+	}
+
+	// The Keystone the token was created with, rather than the identity endpoint of the catalog.
+	identity, err := openstackv2.NewIdentityV3(providerClient, gophercloudv2.EndpointOpts{})
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := tokens3.Get(ctx, identity, providerClient.Token()).ExtractServiceCatalog()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(opts gophercloudv2.EndpointOpts) (string, error) {
+		return openstackv2.V3EndpointURL(catalog, opts)
+	}, nil
+}
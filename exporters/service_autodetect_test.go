@@ -0,0 +1,78 @@
+package exporters
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceAutodetector(t *testing.T) {
+	setupClientPoolTest(t)
+	logger := slog.New(slog.DiscardHandler)
+	pool := NewClientPool()
+	detector := NewServiceAutodetector(pool, time.Hour)
+
+	services, err := detector.Services(context.Background(), cloudName, "public", logger)
+	require.NoError(t, err)
+	assert.Contains(t, services, "compute")
+	assert.Contains(t, services, "network")
+
+	// The detected services are reused until the interval has passed.
+	pool.InvalidateAll()
+	_, err = detector.Services(context.Background(), cloudName, "public", logger)
+	require.NoError(t, err)
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["POST http://test.cloud:35357/v3/auth/tokens"])
+
+	// Failing to detect again keeps the previously detected services.
+	detector.SetInterval(0)
+	calls := httpmock.GetTotalCallCount()
+	httpmock.RegisterResponder("POST", "http://test.cloud:35357/v3/auth/tokens", httpmock.NewStringResponder(503, ""))
+	again, err := detector.Services(context.Background(), cloudName, "public", logger)
+	require.NoError(t, err)
+	assert.Equal(t, services, again)
+	assert.Greater(t, httpmock.GetTotalCallCount(), calls)
+
+	// Without previously detected services the error is returned.
+	detector.InvalidateAll()
+	_, err = detector.Services(context.Background(), cloudName, "public", logger)
+	assert.Error(t, err)
+}
+
+func TestServiceAutodetectorCatalogChange(t *testing.T) {
+	setupClientPoolTest(t)
+	logger := slog.New(slog.DiscardHandler)
+	detector := NewServiceAutodetector(NewClientPool(), 0)
+
+	services, err := detector.Services(context.Background(), cloudName, "public", logger)
+	require.NoError(t, err)
+	assert.Contains(t, services, "volume")
+
+	// The volume service is removed from the catalog, the pooled token stays valid.
+	var tokens map[string]any
+	data, err := os.ReadFile(path.Join(baseFixturePath, "tokens.json"))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &tokens))
+	token := tokens["token"].(map[string]any)
+	token["catalog"] = slices.DeleteFunc(token["catalog"].([]any), func(entry any) bool {
+		return entry.(map[string]any)["type"] == "volumev3"
+	})
+	data, err = json.Marshal(tokens)
+	require.NoError(t, err)
+	httpmock.RegisterResponder("GET", "http://test.cloud:35357/v3/auth/tokens",
+		httpmock.NewBytesResponder(200, data).HeaderSet(map[string][]string{"X-Subject-Token": {"1234"}}))
+
+	services, err = detector.Services(context.Background(), cloudName, "public", logger)
+	require.NoError(t, err)
+	assert.NotContains(t, services, "volume")
+	assert.Contains(t, services, "compute")
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["POST http://test.cloud:35357/v3/auth/tokens"])
+}
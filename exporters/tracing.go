@@ -0,0 +1,33 @@
+package exporters
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerProvider creates the spans of the collections and of the API requests, it is the global
+// TracerProvider, which does nothing unless tracing is configured.
+var tracerProvider = otel.GetTracerProvider()
+
+// tracer creates the spans of the collections.
+var tracer = tracerProvider.Tracer("github.com/openstack-exporter/openstack-exporter/exporters")
+
+// Attributes of the spans of the collections.
+var (
+	attributeService = attribute.Key("openstack.service")
+	attributeMetric  = attribute.Key("openstack.metric")
+	attributeCloud   = attribute.Key("openstack.cloud")
+)
+
+// newTracingTransport returns a transport creating a span for every request sent with next,
+// as a child of the span of the request's context.
+func newTracingTransport(next http.RoundTripper, cloud string) http.RoundTripper {
+	return otelhttp.NewTransport(next,
+		otelhttp.WithTracerProvider(tracerProvider),
+		otelhttp.WithSpanOptions(trace.WithAttributes(attributeCloud.String(cloud))),
+	)
+}
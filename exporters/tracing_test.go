@@ -0,0 +1,62 @@
+package exporters
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRunCollectionSpans(t *testing.T) {
+	setupClientPoolTest(t)
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previousProvider, previousTracer := tracerProvider, tracer
+	tracerProvider, tracer = provider, provider.Tracer("test")
+	t.Cleanup(func() { tracerProvider, tracer = previousProvider, previousTracer })
+	logger := slog.New(slog.DiscardHandler)
+
+	httpmock.RegisterResponder("GET", "http://test.cloud/compute/v2.1/servers/detail",
+		httpmock.NewStringResponder(500, `{}`))
+
+	client, err := NewClientPool().ServiceClient(context.Background(), "compute", cloudName, "public", logger)
+	require.NoError(t, err)
+
+	exporter := BaseOpenStackExporter{
+		Name:           "nova",
+		ExporterConfig: ExporterConfig{Prefix: "openstack", ServiceName: "compute", ClientV2: client},
+		logger:         logger,
+	}
+	exporter.AddMetric("servers", func(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+		_, err := exporter.ClientV2.Get(ctx, "http://test.cloud/compute/v2.1/servers/detail", nil, nil)
+		return err
+	}, nil, "", nil)
+
+	ctx, scrape := provider.Tracer("test").Start(context.Background(), "scrape")
+	err = exporter.RunCollection(ctx, exporter.Metrics["servers"], "servers", make(chan prometheus.Metric), logger)
+	scrape.End()
+	require.Error(t, err)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	collection, ok := spans["RunCollection"]
+	require.True(t, ok)
+	assert.Equal(t, scrape.SpanContext().SpanID(), collection.Parent().SpanID())
+	assert.Contains(t, collection.Attributes(), attributeService.String("compute"))
+	assert.Contains(t, collection.Attributes(), attributeMetric.String("servers"))
+	assert.Equal(t, codes.Error, collection.Status().Code)
+
+	request, ok := spans["HTTP GET"]
+	require.True(t, ok)
+	assert.Equal(t, collection.SpanContext().SpanID(), request.Parent().SpanID())
+	assert.Contains(t, request.Attributes(), attributeCloud.String(cloudName))
+}
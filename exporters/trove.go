@@ -87,7 +87,7 @@ var defaultTroveMetrics = []Metric{
 func NewTroveExporter(config *ExporterConfig, logger *slog.Logger) (*TroveExporter, error) {
 	exporter := TroveExporter{
 		BaseOpenStackExporter{
-			Name:           "trove",
+			Name:           exporterNames["database"],
 			ExporterConfig: *config,
 			logger:         logger,
 		},
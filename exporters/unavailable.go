@@ -0,0 +1,90 @@
+package exporters
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons an exporter could not be created, in addition to the ones of collectErrorReason.
+const (
+	enableErrorEndpointNotFound = "endpoint_not_found"
+	enableErrorHTTP401          = "http_401"
+	enableErrorCircuitOpen      = "circuit_open"
+)
+
+// UnavailableServices reports the services whose exporter could not be created, e.g. while Keystone is down:
+// the up metric of their exporter is 0, and the reason is exposed along with it.
+type UnavailableServices struct {
+	prefix      string
+	up          map[string]*prometheus.Desc
+	reasons     map[string]string
+	unavailable *prometheus.Desc
+}
+
+// NewUnavailableServices returns an empty UnavailableServices, services are added with Add.
+func NewUnavailableServices(prefix string) *UnavailableServices {
+	return &UnavailableServices{
+		prefix:  prefix,
+		up:      make(map[string]*prometheus.Desc),
+		reasons: make(map[string]string),
+		unavailable: prometheus.NewDesc(
+			fmt.Sprintf("%s_exporter_service_unavailable", prefix),
+			"Set to 1 when the exporter of the service could not be created, with the reason",
+			[]string{"service", "reason"}, nil,
+		),
+	}
+}
+
+// Add records that the exporter of service failed to be enabled with err.
+// It must not be called once the UnavailableServices is registered.
+func (u *UnavailableServices) Add(service string, err error) {
+	name, ok := exporterNames[service]
+	if !ok {
+		name = service
+	}
+
+	u.up[service] = prometheus.NewDesc(
+		prometheus.BuildFQName(fmt.Sprintf("%s_%s", u.prefix, name), "", "up"),
+		"up", nil, nil,
+	)
+	u.reasons[service] = enableErrorReason(err)
+}
+
+// Len returns the number of unavailable services.
+func (u *UnavailableServices) Len() int {
+	return len(u.reasons)
+}
+
+func (u *UnavailableServices) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range u.up {
+		ch <- desc
+	}
+	ch <- u.unavailable
+}
+
+func (u *UnavailableServices) Collect(ch chan<- prometheus.Metric) {
+	for service, reason := range u.reasons {
+		ch <- prometheus.MustNewConstMetric(u.up[service], prometheus.GaugeValue, 0)
+		ch <- prometheus.MustNewConstMetric(u.unavailable, prometheus.GaugeValue, 1, service, reason)
+	}
+}
+
+// enableErrorReason classifies the error returned when enabling an exporter.
+func enableErrorReason(err error) string {
+	var endpointErr gophercloud.ErrEndpointNotFound
+	var codeErr gophercloud.ErrUnexpectedResponseCode
+
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		return enableErrorCircuitOpen
+	case errors.As(err, &endpointErr):
+		return enableErrorEndpointNotFound
+	case errors.As(err, &codeErr) && codeErr.Actual == 401:
+		return enableErrorHTTP401
+	}
+
+	return collectErrorReason(err)
+}
@@ -0,0 +1,55 @@
+package exporters
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExporterNames(t *testing.T) {
+	for _, service := range SupportedExporters {
+		assert.Contains(t, exporterNames, service)
+	}
+}
+
+func TestEnableErrorReason(t *testing.T) {
+	tests := []struct {
+		err    error
+		reason string
+	}{
+		{fmt.Errorf("failed to create client: %w", gophercloud.ErrEndpointNotFound{}), enableErrorEndpointNotFound},
+		{gophercloud.ErrUnexpectedResponseCode{Actual: 401}, enableErrorHTTP401},
+		{gophercloud.ErrUnexpectedResponseCode{Actual: 503}, collectErrorHTTP5xx},
+		{errors.New("boom"), collectErrorOther},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.reason, enableErrorReason(test.err), "error: %v", test.err)
+	}
+}
+
+func TestUnavailableServices(t *testing.T) {
+	unavailable := NewUnavailableServices("openstack")
+	unavailable.Add("compute", gophercloud.ErrUnexpectedResponseCode{Actual: 401})
+	unavailable.Add("network", fmt.Errorf("failed to create client: %w", gophercloud.ErrEndpointNotFound{}))
+	assert.Equal(t, 2, unavailable.Len())
+
+	expected := `
+# HELP openstack_exporter_service_unavailable Set to 1 when the exporter of the service could not be created, with the reason
+# TYPE openstack_exporter_service_unavailable gauge
+openstack_exporter_service_unavailable{reason="endpoint_not_found",service="network"} 1
+openstack_exporter_service_unavailable{reason="http_401",service="compute"} 1
+# HELP openstack_neutron_up up
+# TYPE openstack_neutron_up gauge
+openstack_neutron_up 0
+# HELP openstack_nova_up up
+# TYPE openstack_nova_up gauge
+openstack_nova_up 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(unavailable, strings.NewReader(expected)))
+}
@@ -36,9 +36,10 @@ var serviceCatalogTypesByExporterService = map[string][]string{
 	"orchestration":   {"orchestration"},
 	"placement":       {"placement"},
 	"sharev2":         {"shared-file-system", "sharev2"},
+	"instance-ha":     {"instance-ha"},
 }
 
-func AuthenticatedClientV2(opts *clientconfigv2.ClientOpts, transport http.RoundTripper) (*gophercloudv2.ProviderClient, error) {
+func AuthenticatedClientV2(ctx context.Context, opts *clientconfigv2.ClientOpts, transport http.RoundTripper) (*gophercloudv2.ProviderClient, error) {
 	options, err := clientconfigv2.AuthOptions(opts)
 	if err != nil {
 		return nil, err
@@ -60,14 +61,17 @@ func AuthenticatedClientV2(opts *clientconfigv2.ClientOpts, transport http.Round
 		client.HTTPClient.Transport = transport
 	}
 
-	err = openstackv2.Authenticate(context.TODO(), client, *options)
+	// The client may be shared between concurrent scrapes, see ClientPool.
+	client.UseTokenLock()
+
+	err = openstackv2.Authenticate(ctx, client, *options)
 	if err != nil {
 		return nil, err
 	}
 	return client, nil
 }
 
-func newAuthenticatedProviderClient(opts *clientconfigv2.ClientOpts, transport http.RoundTripper, endpointType string) (*gophercloudv2.ProviderClient, *clientconfigv2.Cloud, gophercloudv2.EndpointOpts, error) {
+func newAuthenticatedProviderClient(ctx context.Context, opts *clientconfigv2.ClientOpts, transport http.RoundTripper, endpointType string) (*gophercloudv2.ProviderClient, *clientconfigv2.Cloud, gophercloudv2.EndpointOpts, error) {
 	cloud := new(clientconfigv2.Cloud)
 
 	if opts == nil {
@@ -96,7 +100,7 @@ func newAuthenticatedProviderClient(opts *clientconfigv2.ClientOpts, transport h
 		}
 	}
 
-	pClient, err := AuthenticatedClientV2(opts, transport)
+	pClient, err := AuthenticatedClientV2(ctx, opts, transport)
 	if err != nil {
 		return nil, nil, gophercloudv2.EndpointOpts{}, err
 	}
@@ -124,12 +128,17 @@ func newAuthenticatedProviderClient(opts *clientconfigv2.ClientOpts, transport h
 	return pClient, cloud, eo, nil
 }
 
-func NewServiceClientV2(service string, opts *clientconfigv2.ClientOpts, transport http.RoundTripper, endpointType string) (*gophercloudv2.ServiceClient, error) {
-	pClient, cloud, eo, err := newAuthenticatedProviderClient(opts, transport, endpointType)
+func NewServiceClientV2(ctx context.Context, service string, opts *clientconfigv2.ClientOpts, transport http.RoundTripper, endpointType string) (*gophercloudv2.ServiceClient, error) {
+	pClient, cloud, eo, err := newAuthenticatedProviderClient(ctx, opts, transport, endpointType)
 	if err != nil {
 		return nil, err
 	}
 
+	return newServiceClientFromProviderV2(service, pClient, cloud, eo)
+}
+
+// newServiceClientFromProviderV2 creates a ServiceClient for the given exporter service from an already authenticated ProviderClient.
+func newServiceClientFromProviderV2(service string, pClient *gophercloudv2.ProviderClient, cloud *clientconfigv2.Cloud, eo gophercloudv2.EndpointOpts) (*gophercloudv2.ServiceClient, error) {
 	// Keep a map of the EndpointOpts for each service
 	endpointOptsV2Mu.Lock()
 	if endpointOptsV2 == nil {
@@ -182,6 +191,8 @@ func NewServiceClientV2(service string, opts *clientconfigv2.ClientOpts, transpo
 		return openstackv2.NewPlacementV1(pClient, eo)
 	case "sharev2":
 		return openstackv2.NewSharedFileSystemV2(pClient, eo)
+	case "instance-ha":
+		return NewInstanceHAV1(pClient, eo)
 	case "volume":
 		volumeVersion := "3"
 		if v := cloud.VolumeAPIVersion; v != "" {
@@ -203,6 +214,21 @@ func NewServiceClientV2(service string, opts *clientconfigv2.ClientOpts, transpo
 	return nil, fmt.Errorf("unable to create a service client for %s", service)
 }
 
+// NewInstanceHAV1 creates a ServiceClient for the Masakari v1 API.
+// Gophercloud has no instance-ha package, so this follows what gnocchi does in gophercloud/utils.
+func NewInstanceHAV1(client *gophercloudv2.ProviderClient, eo gophercloudv2.EndpointOpts) (*gophercloudv2.ServiceClient, error) {
+	sc := new(gophercloudv2.ServiceClient)
+	eo.ApplyDefaults("instance-ha")
+	url, err := client.EndpointLocator(eo)
+	if err != nil {
+		return sc, err
+	}
+	sc.ProviderClient = client
+	sc.Endpoint = url
+	sc.Type = "instance-ha"
+	return sc, nil
+}
+
 // GetProjects returns all projects for the configured domain or just the configured project.
 func GetProjects(ctx context.Context, exporter *BaseOpenStackExporter) ([]projects.Project, error) {
 	c, err := newIdentityV3ClientV2FromExporter(exporter, exporter.ServiceName)
@@ -285,15 +311,27 @@ func mapStatus(mapping map[string]int, current string) int {
 	return v
 }
 
-func AutodetectServicesFromCatalog(opts *clientconfigv2.ClientOpts, transport http.RoundTripper, endpointType string) ([]string, error) {
-	providerClient, _, endpointOpts, err := newAuthenticatedProviderClient(opts, transport, endpointType)
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func AutodetectServicesFromCatalog(ctx context.Context, opts *clientconfigv2.ClientOpts, transport http.RoundTripper, endpointType string) ([]string, error) {
+	providerClient, _, endpointOpts, err := newAuthenticatedProviderClient(ctx, opts, transport, endpointType)
 	if err != nil {
 		return nil, err
 	}
 
+	return servicesFromCatalog(providerClient.EndpointLocator, endpointOpts)
+}
+
+// servicesFromCatalog returns the supported services whose endpoint is found in a catalog by locate.
+func servicesFromCatalog(locate gophercloudv2.EndpointLocator, endpointOpts gophercloudv2.EndpointOpts) ([]string, error) {
 	enabledServices := make([]string, 0, len(SupportedExporters))
 	for _, service := range SupportedExporters {
-		if !isServiceAvailable(providerClient, endpointOpts, service) {
+		if !isServiceAvailable(locate, endpointOpts, service) {
 			continue
 		}
 		enabledServices = append(enabledServices, service)
@@ -306,7 +344,7 @@ func AutodetectServicesFromCatalog(opts *clientconfigv2.ClientOpts, transport ht
 	return enabledServices, nil
 }
 
-func isServiceAvailable(providerClient *gophercloudv2.ProviderClient, endpointOpts gophercloudv2.EndpointOpts, service string) bool {
+func isServiceAvailable(locate gophercloudv2.EndpointLocator, endpointOpts gophercloudv2.EndpointOpts, service string) bool {
 	serviceTypes, ok := serviceCatalogTypesByExporterService[service]
 	if !ok {
 		return false
@@ -315,7 +353,7 @@ func isServiceAvailable(providerClient *gophercloudv2.ProviderClient, endpointOp
 	for _, serviceType := range serviceTypes {
 		eo := endpointOpts
 		eo.ApplyDefaults(serviceType)
-		endpoint, err := providerClient.EndpointLocator(eo)
+		endpoint, err := locate(eo)
 		if err == nil && endpoint != "" {
 			return true
 		}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/openstack-exporter/openstack-exporter/cache"
+	"github.com/openstack-exporter/openstack-exporter/exporters"
+	"golang.org/x/sync/errgroup"
+)
+
+// readyTimeout bounds the Keystone authentication done by /-/ready.
+const readyTimeout = 10 * time.Second
+
+// cacheCollected is set once the first collection of the cache background service has finished,
+// or when caches were loaded from the disk backend at startup.
+var cacheCollected atomic.Bool
+
+// healthyHandler reports that the process is running.
+func healthyHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "OpenStack Exporter is Healthy.")
+}
+
+// readyHandler reports whether the exporter can serve scrapes: Keystone authentication succeeds for
+// at least one configured cloud and, in cache mode, its cache has been collected within the TTL. The
+// cloud query parameter checks that cloud only. The problems of the other clouds are listed in the body.
+// The pooled clients are used, so a cloud is only authenticated again when its token is about to expire.
+func readyHandler(logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+
+		clouds := []string{r.URL.Query().Get("cloud")}
+		if clouds[0] == "" {
+			var err error
+			if clouds, err = configuredClouds(); err != nil {
+				http.Error(w, fmt.Sprintf("failed to load clouds.yaml: %s", err), http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		ready, problems := readiness(ctx, clouds, logger)
+		if !ready {
+			logger.Debug("Exporter is not ready", "problems", problems)
+			http.Error(w, strings.Join(problems, "\n"), http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "OpenStack Exporter is Ready.")
+		for _, problem := range problems {
+			fmt.Fprintln(w, problem)
+		}
+	}
+}
+
+// readiness reports whether at least one of clouds is ready, along with the problems of the others.
+func readiness(ctx context.Context, clouds []string, logger *slog.Logger) (bool, []string) {
+	if len(clouds) == 0 {
+		return false, []string{"no cloud configured"}
+	}
+
+	if *cacheEnable && !cacheCollected.Load() {
+		return false, []string{"first cache collection not finished"}
+	}
+
+	cloudProblems := make([]string, len(clouds))
+	var g errgroup.Group
+	g.SetLimit(cloudConcurrency)
+	for i, cloud := range clouds {
+		g.Go(func() error {
+			cloudProblems[i] = cloudReadinessProblem(ctx, cloud, logger)
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	problems := []string{}
+	for _, problem := range cloudProblems {
+		if problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+
+	return len(problems) < len(clouds), problems
+}
+
+// cloudReadinessProblem returns why cloud is not ready, an empty string when it is.
+func cloudReadinessProblem(ctx context.Context, cloud string, logger *slog.Logger) string {
+	if _, _, err := exporters.GetClientPool().ProviderClient(ctx, cloud, *endpointType, logger); err != nil {
+		return fmt.Sprintf("cloud %s: keystone authentication failed: %s", cloud, err)
+	}
+
+	if *cacheEnable {
+		cloudCache, ok := cache.GetCache().GetCloudCache(cloud)
+		if !ok {
+			return fmt.Sprintf("cloud %s: no cached metrics", cloud)
+		}
+		if age := time.Since(cloudCache.Time); age > *cacheTTL {
+			return fmt.Sprintf("cloud %s: cached metrics are stale, collected %s ago", cloud, age.Round(time.Second))
+		}
+	}
+
+	return ""
+}
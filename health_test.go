@@ -0,0 +1,137 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/openstack-exporter/openstack-exporter/cache"
+	"github.com/openstack-exporter/openstack-exporter/exporters"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupReadyTest(t *testing.T) {
+	httpmock.Activate()
+	t.Cleanup(httpmock.DeactivateAndReset)
+
+	t.Setenv("OS_CLIENT_CONFIG_FILE", "exporters/fixtures/test_config.yaml")
+	tokens, err := os.ReadFile("exporters/fixtures/tokens.json")
+	require.NoError(t, err)
+	httpmock.RegisterResponder("POST", "http://test.cloud:35357/v3/auth/tokens",
+		httpmock.NewBytesResponder(201, tokens).HeaderSet(map[string][]string{
+			"X-Subject-Token": {"1234"},
+		}))
+	httpmock.RegisterResponder("GET", "http://test.cloud:35357/v3/auth/tokens",
+		httpmock.NewBytesResponder(200, tokens).HeaderSet(map[string][]string{
+			"X-Subject-Token": {"1234"},
+		}))
+
+	previousCloud, previousMultiCloud, previousCache, previousTTL := *cloud, *multiCloud, *cacheEnable, *cacheTTL
+	*cloud, *multiCloud = "test.cloud", false
+	t.Cleanup(func() {
+		*cloud, *multiCloud, *cacheEnable, *cacheTTL = previousCloud, previousMultiCloud, previousCache, previousTTL
+		cacheCollected.Store(false)
+		exporters.GetClientPool().InvalidateAll()
+	})
+	exporters.GetClientPool().InvalidateAll()
+}
+
+func ready(t *testing.T, target string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	readyHandler(slog.New(slog.DiscardHandler))(rr, httptest.NewRequest(http.MethodGet, target, nil))
+	return rr
+}
+
+func TestHealthyHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	healthyHandler(rr, httptest.NewRequest(http.MethodGet, "/-/healthy", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestReadyHandler(t *testing.T) {
+	setupReadyTest(t)
+	assert.Equal(t, http.StatusOK, ready(t, "/-/ready").Code)
+
+	exporters.GetClientPool().InvalidateAll()
+	httpmock.RegisterResponder("POST", "http://test.cloud:35357/v3/auth/tokens", httpmock.NewStringResponder(401, ""))
+	rr := ready(t, "/-/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), "keystone authentication failed")
+}
+
+func TestReadyHandlerMultiCloud(t *testing.T) {
+	setupReadyTest(t)
+	*multiCloud = true
+	cloudsYAML := filepath.Join(t.TempDir(), "clouds.yaml")
+	config, err := os.ReadFile("exporters/fixtures/test_config.yaml")
+	require.NoError(t, err)
+	config = append(config, []byte(`
+  down.cloud:
+    region_name: RegionOne
+    auth:
+      username: 'admin'
+      password: 'admin'
+      project_name: 'admin'
+      auth_url: 'http://down.cloud:35357/v3'`)...)
+	require.NoError(t, os.WriteFile(cloudsYAML, config, 0o600))
+	t.Setenv("OS_CLIENT_CONFIG_FILE", cloudsYAML)
+	httpmock.RegisterResponder("POST", "http://down.cloud:35357/v3/auth/tokens", httpmock.NewStringResponder(503, ""))
+
+	// One cloud down does not make the exporter unready for the other clouds.
+	rr := ready(t, "/-/ready")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "cloud down.cloud: keystone authentication failed")
+
+	assert.Equal(t, http.StatusOK, ready(t, "/-/ready?cloud=test.cloud").Code)
+	rr = ready(t, "/-/ready?cloud=down.cloud")
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), "cloud down.cloud: keystone authentication failed")
+
+	exporters.GetClientPool().InvalidateAll()
+	httpmock.RegisterResponder("POST", "http://test.cloud:35357/v3/auth/tokens", httpmock.NewStringResponder(401, ""))
+	assert.Equal(t, http.StatusServiceUnavailable, ready(t, "/-/ready").Code)
+}
+
+func TestReadyHandlerCache(t *testing.T) {
+	setupReadyTest(t)
+	*cacheEnable, *cacheTTL = true, time.Hour
+
+	rr := ready(t, "/-/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), "first cache collection not finished")
+
+	cacheCollected.Store(true)
+	cache.GetCache().SetCloudCache("test.cloud", cache.NewCloudCache())
+	assert.Equal(t, http.StatusOK, ready(t, "/-/ready").Code)
+
+	*cacheTTL = time.Nanosecond
+	rr = ready(t, "/-/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), "stale")
+}
+
+func TestMetricHandlerKeystoneDown(t *testing.T) {
+	setupReadyTest(t)
+	previousServices, previousPrefix, previousEndpointType, previousConfig := enabledServices.Load(), *prefix, *endpointType, *osClientConfig
+	enabledServices.Store(&[]string{"compute", "network"})
+	*prefix, *endpointType, *osClientConfig = "openstack", "public", "exporters/fixtures/test_config.yaml"
+	t.Cleanup(func() {
+		enabledServices.Store(previousServices)
+		*prefix, *endpointType, *osClientConfig = previousPrefix, previousEndpointType, previousConfig
+	})
+	httpmock.RegisterResponder("POST", "http://test.cloud:35357/v3/auth/tokens", httpmock.NewStringResponder(401, ""))
+
+	rr := httptest.NewRecorder()
+	metricHandler(slog.New(slog.DiscardHandler))(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), "openstack_nova_up 0")
+	assert.Contains(t, rr.Body.String(), "openstack_neutron_up 0")
+	assert.Contains(t, rr.Body.String(), `openstack_exporter_service_unavailable{reason="http_401",service="compute"} 1`)
+}
@@ -78,6 +78,7 @@ func startOpenStackExporter(enabledServices []string) (string, func(), error) {
 	prefix := "openstack"
 	endpointType := "public"
 	collectTime := false
+	metricTimeout := time.Duration(0)
 	disabledMetrics := []string{}
 	disableSlowMetrics := false
 	disableDeprecatedMetrics := false
@@ -97,19 +98,20 @@ func startOpenStackExporter(enabledServices []string) (string, func(), error) {
 
 	// Context to control exporter lifecycle
 	ctx, cancel := context.WithCancel(context.Background())
-	_ = ctx // currently unused but kept for potential future use
 
 	registry := prometheus.NewPedanticRegistry()
 
 	enabledExporters := 0
 	for _, service := range enabledServices {
 		exp, err := exporters.EnableExporter(
+			ctx,
 			service,
 			prefix,
 			cloud,
 			disabledMetrics,
 			endpointType,
 			collectTime,
+			metricTimeout,
 			disableSlowMetrics,
 			disableDeprecatedMetrics,
 			disableCinderAgentUUID,
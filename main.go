@@ -5,11 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -20,16 +25,22 @@ import (
 	"github.com/hashicorp/vault-client-go"
 	"github.com/hashicorp/vault-client-go/schema"
 	"github.com/openstack-exporter/openstack-exporter/cache"
+	"github.com/openstack-exporter/openstack-exporter/config"
 	"github.com/openstack-exporter/openstack-exporter/exporters"
 	"github.com/openstack-exporter/openstack-exporter/utils"
 	"github.com/prometheus/client_golang/prometheus"
 	pver "github.com/prometheus/client_golang/prometheus/collectors/version"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/promslog"
 	"github.com/prometheus/common/promslog/flag"
 	"github.com/prometheus/common/version"
 	"github.com/prometheus/exporter-toolkit/web"
 	webflag "github.com/prometheus/exporter-toolkit/web/kingpinflag"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const DEFAULT_OS_CLIENT_CONFIG = "/etc/openstack/clouds.yaml"
@@ -44,10 +55,21 @@ const (
 
 var (
 	metrics                  = kingpin.Flag("web.telemetry-path", "uri path to expose metrics").Default("/metrics").String()
+	enableOpenMetrics        = kingpin.Flag("web.enable-openmetrics", "Expose the metrics in the OpenMetrics format to the scrapers asking for it").Default("false").Bool()
 	osClientConfig           = kingpin.Flag("os-client-config", "Path to the cloud configuration file").Default(DEFAULT_OS_CLIENT_CONFIG).String()
 	prefix                   = kingpin.Flag("prefix", "Prefix for metrics").Default("openstack").String()
 	endpointType             = kingpin.Flag("endpoint-type", "openstack endpoint type to use (i.e: public, internal, admin)").Default("public").String()
 	collectTime              = kingpin.Flag("collect-metric-time", "time spent collecting each metric").Default("false").Bool()
+	collectTimeout           = kingpin.Flag("collect-metric-timeout", "Deadline for collecting each metric, 0 disables it (eg. 10s, 1m)").Default("0s").Duration()
+	probeCacheWindow         = kingpin.Flag("probe.cache-window", "How long the result of a probe is reused by the identical probes following it, 0 only shares it with the concurrent ones (eg. 10s)").Default("0s").Duration()
+	apiRateLimit             = kingpin.Flag("api.rate-limit", "Requests per second to the API of each service of a cloud, 0 disables the limit").Default("0").Float64()
+	apiRateLimitBurst        = kingpin.Flag("api.rate-limit-burst", "Requests to the API of each service of a cloud made at once before --api.rate-limit applies").Default("10").Int()
+	apiMaxInFlight           = kingpin.Flag("api.max-in-flight", "Requests to the API of each service of a cloud running at the same time, 0 disables the limit").Default("0").Int()
+	apiRetries               = kingpin.Flag("api.retries", "Retries of the GET requests to the OpenStack APIs getting a 5xx or 429 response, or whose connection was reset, 0 disables them").Default("0").Int()
+	apiRetryBackoff          = kingpin.Flag("api.retry-backoff", "Delay before the first retry of a request, doubled on every retry, unless the response sets Retry-After").Default("0.5s").Duration()
+	circuitBreakerFailures   = kingpin.Flag("circuit-breaker.failures", "Consecutive failed collections of a service of a cloud after which it is not collected during --circuit-breaker.cool-down, 0 disables the circuit breakers").Default("0").Int()
+	circuitBreakerCoolDown   = kingpin.Flag("circuit-breaker.cool-down", "How long a service is not collected once its circuit breaker opened (eg. 1m, 5m)").Default("1m").Duration()
+	scrapeTimeoutOffset      = kingpin.Flag("scrape-timeout-offset", "Offset to subtract from the timeout sent by Prometheus in the X-Prometheus-Scrape-Timeout-Seconds header").Default("0.5s").Duration()
 	disabledMetrics          = kingpin.Flag("disable-metric", "multiple --disable-metric can be specified in the format: service-metric (i.e: cinder-snapshots)").Default("").Short('d').Strings()
 	disableSlowMetrics       = kingpin.Flag("disable-slow-metrics", "Disable slow metrics for performance reasons").Default("false").Bool()
 	disableDeprecatedMetrics = kingpin.Flag("disable-deprecated-metrics", "Disable deprecated metrics").Default("false").Bool()
@@ -57,12 +79,33 @@ var (
 	domainID                 = kingpin.Flag("domain-id", "Gather metrics only for the given Domain ID (defaults to all domains)").String()
 	cacheEnable              = kingpin.Flag("cache", "Enable Cache mechanism globally").Default("false").Bool()
 	cacheTTL                 = kingpin.Flag("cache-ttl", "TTL duration for cache expiry(eg. 10s, 11m, 1h)").Default("300s").Duration()
+	cacheBackend             = kingpin.Flag("cache.backend", "Where the cache is stored: memory, disk to keep it across restarts, or redis to share it between replicas").Default("memory").Enum("memory", "disk", "redis")
+	cacheDir                 = kingpin.Flag("cache.dir", "Directory of the disk cache backend").Default("data/cache").String()
+	cacheRedisURL            = kingpin.Flag("cache.redis-url", "URL of the server of the redis cache backend (eg. redis://:password@redis:6379/0)").Default("redis://localhost:6379/0").String()
+	cacheRedisKeyPrefix      = kingpin.Flag("cache.redis-key-prefix", "Prefix of the keys of the redis cache backend").Default("openstack-exporter:").String()
+	cacheCloudsConcurrency   = kingpin.Flag("cache.clouds-concurrency", "Number of clouds collected at the same time in cache mode").Default("4").Int()
+	cacheServicesConcurrency = kingpin.Flag("cache.services-concurrency", "Number of services of a cloud collected at the same time in cache mode").Default("2").Int()
+	cacheRetryBackoff        = kingpin.Flag("cache.retry-backoff", "Delay before retrying a failed cache collection of a cloud, doubled on every retry until the next collection").Default("5s").Duration()
+	cacheMaxStale            = kingpin.Flag("cache.max-stale", "How long the cached metrics of a service are served when collecting it fails, when longer than the cache TTL (eg. 30m, 1h)").Default("0s").Duration()
 	tenantID                 = kingpin.Flag("project-id", "Gather metrics only for the given Project ID (defaults to all projects)").String()
-	disableServiceAutodetect = kingpin.Flag("disable-service-autodetect", "Disable single-cloud service autodetection and use only explicit service flags").Default("false").Bool()
+	disableServiceAutodetect = kingpin.Flag("disable-service-autodetect", "Disable service autodetection and use only explicit service flags").Default("false").Bool()
+	autodetectInterval       = kingpin.Flag("service-autodetect-interval", "How often the services of each cloud are detected again in multi cloud mode (eg. 30m, 1h)").Default("1h").Duration()
 	novaMetadataMapping      = utils.LabelMapping(kingpin.Flag("nova.metadata-extra-labels", "Map provided server metadata keys to labels in openstack_nova_server_status metric").PlaceHolder("LABEL=KEY,KEY").Default(""))
 	dnsConcurrentCount       = kingpin.Flag("dns-concurrent-count", "Number of concurrent requests for DNS recordset collection").Default("10").Int()
+	configFile               = kingpin.Flag("config.file", "Path to the configuration file overriding the flags, globally or per cloud").String()
+	configWatch              = kingpin.Flag("config.watch", "Reload the configuration when clouds.yaml or the configuration file change").Default("false").Bool()
+	enableCacheRefresh       = kingpin.Flag("web.enable-cache-refresh", "Enable forcing the cache collection of a cloud via HTTP POST to /-/cache/refresh").Default("false").Bool()
+	tracingEndpoint          = kingpin.Flag("tracing.otlp-endpoint", "URL of the OTLP HTTP endpoint the traces of the scrapes are exported to, tracing is disabled when empty (eg. http://otel-collector:4318)").Default("").String()
+	tracingSamplingRatio     = kingpin.Flag("tracing.sampling-ratio", "Ratio of the scrapes traced, when the scraper did not send a sampled trace").Default("1.0").Float64()
+	enableLifecycle          = kingpin.Flag("web.enable-lifecycle", "Enable reloading the configuration via HTTP POST to /-/reload").Default("false").Bool()
 )
 
+// exporterConfig is the content of --config.file, nil when not set.
+var exporterConfig atomic.Pointer[config.Config]
+
+// errLeadershipLost stops a collection when another replica took the leadership of the shared cache over.
+var errLeadershipLost = errors.New("another replica took the leadership of the cache over")
+
 func main() {
 
 	serviceStates := make(map[string]serviceState, len(exporters.SupportedExporters))
@@ -101,18 +144,39 @@ func main() {
 		os.Setenv("OS_CLIENT_CONFIG_FILE", *osClientConfig)
 	}
 
-	SetPasswordIfVaultIsUsed(logger)
-
-	if _, err := os.Stat(*osClientConfig); err != nil {
-		logger.Error("Could not read config file", "error", err)
+	exporters.GetServiceAutodetector().SetInterval(*autodetectInterval)
+	exporters.GetClientPool().SetMetricsPrefix(*prefix)
+	exporters.GetClientPool().SetConfigFile(*osClientConfig)
+	exporters.GetClientPool().SetRateLimits(exporters.RateLimits{Rate: *apiRateLimit, Burst: *apiRateLimitBurst, MaxInFlight: *apiMaxInFlight})
+	exporters.GetClientPool().SetRetries(exporters.Retries{Max: *apiRetries, Backoff: *apiRetryBackoff})
+	exporters.GetCircuitBreakers().SetPolicy(*circuitBreakerFailures, *circuitBreakerCoolDown)
+	flagServiceStates = serviceStates
+	if err := reload(logger); err != nil {
+		logger.Error("Failed to load configuration", "error", err)
 		os.Exit(1)
 	}
+	if cfg := exporterConfig.Load(); cfg != nil && cfg.CacheTTL != nil {
+		*cacheTTL = *cfg.CacheTTL
+	}
+	if *cacheEnable {
+		if err := setupCacheBackend(logger); err != nil {
+			logger.Error("Failed to set up the cache backend", "error", err)
+			os.Exit(1)
+		}
+		// Set before the background service and the HTTP server share it.
+		collectSchedule = newCacheSchedule(*cacheCloudsConcurrency)
+	}
 
-	services, err := resolveServiceConfig(*multiCloud, *cloud, *disableServiceAutodetect, serviceStates, logger)
+	shutdownTracing, err := setupTracing(context.Background(), logger)
 	if err != nil {
-		logger.Error("Failed to resolve service configuration", "error", err)
+		logger.Error("Failed to set up tracing", "error", err)
 		os.Exit(1)
 	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error("Failed to shut down tracing", "error", err)
+		}
+	}()
 
 	ctx1, cancel1 := context.WithCancelCause(context.Background())
 	defer cancel1(nil)
@@ -120,13 +184,27 @@ func main() {
 	ctx2, cancel2 := signal.NotifyContext(ctx1, syscall.SIGINT, syscall.SIGTERM)
 	defer cancel2()
 
+	go reloadOnSignal(ctx2, logger)
+	if *configWatch {
+		files := []string{*osClientConfig}
+		if *configFile != "" {
+			files = append(files, *configFile)
+		}
+		go func() {
+			if err := watchConfigFiles(ctx2, files, logger); err != nil {
+				logger.Error("Failed to watch configuration files", "error", err)
+				cancel1(err)
+			}
+		}()
+	}
+
 	// Start the backend service.
 	if *cacheEnable {
-		go cacheBackgroundService(ctx2, services, cancel1, logger)
+		go cacheBackgroundService(ctx2, cancel1, logger)
 	}
 
 	// Start the HTTP server.
-	go startHTTPServer(ctx2, services, toolkitFlags, cancel1, logger)
+	go startHTTPServer(ctx2, toolkitFlags, cancel1, logger)
 
 	<-ctx2.Done()
 	if err := context.Cause(ctx2); err != nil && !errors.Is(err, context.Canceled) {
@@ -142,8 +220,19 @@ func resolveServiceConfig(
 	cloud string,
 	disableAutodetect bool,
 	serviceStates map[string]serviceState,
+	fileServices []string,
 	logger *slog.Logger,
 ) ([]string, error) {
+	// Services of the configuration file replace autodetection, explicit flags still take precedence.
+	if len(fileServices) > 0 {
+		applyAutodetection(serviceStates, fileServices)
+		enabledServices := getEnabledServicesFromStates(serviceStates)
+		if len(enabledServices) == 0 {
+			return nil, errors.New("no services enabled by the configuration file and flags")
+		}
+		return enabledServices, nil
+	}
+
 	if isMultiCloud || disableAutodetect {
 		setAutoServicesState(serviceStates, serviceEnabled)
 		if disableAutodetect && !isMultiCloud {
@@ -202,39 +291,350 @@ func getEnabledServicesFromStates(serviceStates map[string]serviceState) []strin
 
 func autodetectServices(cloud string, logger *slog.Logger) ([]string, error) {
 	opts := &clientconfigv2.ClientOpts{Cloud: cloud}
-	services, err := exporters.AutodetectServicesFromCatalog(opts, nil, *endpointType)
+	services, err := exporters.AutodetectServicesFromCatalog(context.Background(), opts, nil, *endpointType)
 	if err != nil {
 		return nil, err
 	}
 	return services, nil
 }
 
+// flagSettings returns the settings given on the command line.
+func flagSettings() config.Settings {
+	return config.Settings{
+		DisabledMetrics:          *disabledMetrics,
+		DisableSlowMetrics:       disableSlowMetrics,
+		DisableDeprecatedMetrics: disableDeprecatedMetrics,
+		DisableCinderAgentUUID:   disableCinderAgentUUID,
+		DomainID:                 domainID,
+		ProjectID:                tenantID,
+		NovaMetadataMapping:      novaMetadataMapping,
+		ServicesConcurrency:      cacheServicesConcurrency,
+	}
+}
+
+// cloudSettings returns the settings for cloud: the flags, overridden by the configuration file.
+// Every field but Services and RefreshIntervals is set.
+func cloudSettings(cloud string) config.Settings {
+	return flagSettings().Merge(exporterConfig.Load().ForCloud(cloud))
+}
+
+// cloudServices returns the services to scrape for cloud, the ones set for the cloud in
+// the configuration file replacing the configured ones. The explicit service flags still take precedence.
+func cloudServices(cloud string, configuredServices []string) []string {
+	if cfg := exporterConfig.Load(); cfg != nil {
+		if services := cfg.Clouds[cloud].Services; len(services) > 0 {
+			serviceStates := make(map[string]serviceState, len(exporters.SupportedExporters))
+			maps.Copy(serviceStates, flagServiceStates)
+			applyAutodetection(serviceStates, services)
+			return getEnabledServicesFromStates(serviceStates)
+		}
+	}
+	return configuredServices
+}
+
+// servicesForCloud returns the services to scrape for cloud. In multi cloud mode the services
+// missing from the catalog of the cloud are dropped, unless enabled explicitly by a flag or
+// set for the cloud in the configuration file. If the catalog cannot be read, all the services are kept.
+func servicesForCloud(ctx context.Context, cloud string, configuredServices []string, logger *slog.Logger) []string {
+	services := cloudServices(cloud, configuredServices)
+	if !*multiCloud || *disableServiceAutodetect {
+		return services
+	}
+	// The services set for all clouds are only scraped on the clouds having them.
+	if cfg := exporterConfig.Load(); cfg != nil && len(cfg.Clouds[cloud].Services) > 0 {
+		return services
+	}
+
+	detected, err := exporters.GetServiceAutodetector().Services(ctx, cloud, *endpointType, logger)
+	if err != nil {
+		logger.Warn("Failed to autodetect services, using the configured ones", "cloud", cloud, "error", err)
+		return services
+	}
+
+	keep := slices.Clone(detected)
+	for service, state := range flagServiceStates {
+		if state == serviceEnabled {
+			keep = append(keep, service)
+		}
+	}
+
+	return utils.KeepElements(services, keep)
+}
+
+// enableExporter enables the exporter of service for cloud with the given settings.
+func enableExporter(ctx context.Context, service, cloud string, settings config.Settings, logger *slog.Logger) (*exporters.OpenStackExporter, error) {
+	return exporters.EnableExporter(ctx, service, *prefix, cloud, settings.DisabledMetrics, *endpointType, *collectTime, *collectTimeout, *settings.DisableSlowMetrics, *settings.DisableDeprecatedMetrics, *settings.DisableCinderAgentUUID, *settings.DomainID, *settings.ProjectID, settings.NovaMetadataMapping, *dnsConcurrentCount, nil, logger)
+}
+
+// configuredClouds returns the cloud given as argument, or every cloud of clouds.yaml in multi cloud mode.
+func configuredClouds() ([]string, error) {
+	if !*multiCloud {
+		return []string{*cloud}, nil
+	}
+
+	cloudsConfig, err := clientconfigv2.LoadCloudsYAML()
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.Sorted(maps.Keys(cloudsConfig)), nil
+}
+
+// collectCache collects the metrics of every cloud into the cache, each with its own settings.
+// The clouds are collected concurrently, up to --cache.clouds-concurrency at a time, and a cloud
+// whose previous collection is still running is skipped, so that a slow cloud does not delay the others.
+// It returns once the collections it started have finished.
+func collectCache(ctx context.Context, services []string, logger *slog.Logger) error {
+	clouds, err := configuredClouds()
+	if err != nil {
+		// No cloud can be collected until the configuration is fixed, which fails the clouds collected so far.
+		for _, cloud := range collectSchedule.lastClouds() {
+			cache.GetCollectionMetrics(*prefix, cloud).Observe(err)
+		}
+		return err
+	}
+	collectSchedule.setClouds(clouds)
+
+	tick := cacheTick()
+	var wg sync.WaitGroup
+	for _, cloud := range clouds {
+		if !collectSchedule.start(cloud) {
+			logger.Warn("Previous cache collection of the cloud is still running, skipping it", "cloud", cloud)
+			continue
+		}
+
+		wg.Go(func() {
+			defer collectSchedule.finish(cloud)
+			collectCloudCacheWithRetry(ctx, cloud, services, tick, logger)
+		})
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// collectCloudCacheWithRetry collects cloud into the cache, retrying the failed services with an exponential
+// backoff with jitter as long as the retry happens before the next tick, which retries them otherwise.
+// The last cache is served meanwhile, and every failed attempt is counted in the cloud's collection metrics.
+func collectCloudCacheWithRetry(ctx context.Context, cloud string, services []string, tick time.Duration, logger *slog.Logger) {
+	metrics := cache.GetCollectionMetrics(*prefix, cloud)
+	deadline := time.Now().Add(tick)
+
+	for attempt := 0; ; attempt++ {
+		err := collectCloudCache(ctx, cloud, services, nil, tick, logger)
+		if ctx.Err() != nil {
+			return
+		}
+		metrics.Observe(err)
+		if err == nil {
+			return
+		}
+
+		delay := backoffDelay(*cacheRetryBackoff, attempt)
+		if time.Now().Add(delay).After(deadline) {
+			logger.Error("Failed to collect cloud into the cache, retrying on the next collection", "cloud", cloud, "error", err)
+			return
+		}
+		logger.Warn("Failed to collect cloud into the cache, retrying", "cloud", cloud, "delay", delay, "error", err)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// collectCloudCache collects the services of cloud which are due into the cache, or only the services of refresh
+// when set, whatever their refresh interval. The services which failed stay due, so that they are collected
+// again on the next call.
+func collectCloudCache(ctx context.Context, cloud string, services, refresh []string, tick time.Duration, logger *slog.Logger) error {
+	if err := collectSchedule.acquire(ctx); err != nil {
+		return err
+	}
+	defer collectSchedule.release()
+
+	ctx, span := tracer.Start(ctx, "CollectCloudCache", trace.WithAttributes(attribute.String("openstack.cloud", cloud)))
+	defer span.End()
+
+	now := time.Now()
+	settings := cloudSettings(cloud)
+	interval := func(service string) time.Duration { return refreshInterval(cloud, service) }
+	due, later := collectSchedule.due(cloud, servicesForCloud(ctx, cloud, services, logger), interval, now, tick)
+	if refresh != nil {
+		due, later = refresh, utils.RemoveElements(append(due, later...), refresh)
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	// The metrics of the failed services are served at least until the cache TTL.
+	err := cache.CollectCache(ctx, exporters.EnableExporter, due, later, *prefix, cloud, max(*cacheTTL, *cacheMaxStale), *settings.ServicesConcurrency, settings.DisabledMetrics, *endpointType, *collectTime, *collectTimeout, *settings.DisableSlowMetrics, *settings.DisableDeprecatedMetrics, *settings.DisableCinderAgentUUID, *settings.DomainID, *settings.ProjectID, settings.NovaMetadataMapping, *dnsConcurrentCount, nil, logger)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	var serviceErrors cache.ServiceErrors
+	if errors.As(err, &serviceErrors) {
+		collectSchedule.done(cloud, utils.RemoveElements(due, slices.Collect(maps.Keys(serviceErrors))), now)
+		collectSchedule.failed(cloud, serviceErrors, now)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	collectSchedule.done(cloud, due, now)
+
+	return nil
+}
+
+// setupCacheBackend sets the cache backend selected by --cache.backend, the in-memory one being the default.
+func setupCacheBackend(logger *slog.Logger) error {
+	switch *cacheBackend {
+	case "disk":
+		return setupDiskCacheBackend(logger)
+	case "redis":
+		return setupRedisCacheBackend(logger)
+	}
+
+	return nil
+}
+
+// setupDiskCacheBackend sets the cache backend stored in --cache.dir. It is loaded with the caches
+// stored before the restart, which are served until the first collection replaces them.
+func setupDiskCacheBackend(logger *slog.Logger) error {
+	backend, err := cache.NewDiskCache(*cacheDir, logger)
+	if err != nil {
+		return err
+	}
+	backend.FlushExpiredCloudCaches(max(*cacheTTL, *cacheMaxStale))
+	cache.SetCache(backend)
+
+	clouds, err := configuredClouds()
+	if err != nil {
+		return err
+	}
+	for _, cloud := range clouds {
+		if _, exists := backend.GetCloudCache(cloud); exists {
+			cacheCollected.Store(true)
+		}
+	}
+
+	return nil
+}
+
+// setupRedisCacheBackend sets the cache backend shared by the replicas through the server of --cache.redis-url.
+func setupRedisCacheBackend(logger *slog.Logger) error {
+	opts, err := redis.ParseURL(*cacheRedisURL)
+	if err != nil {
+		return fmt.Errorf("invalid --cache.redis-url: %w", err)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	id := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+
+	cache.SetCache(cache.NewRedisCache(redis.NewClient(opts), *cacheRedisKeyPrefix, id, logger))
+	logger.Info("Using the redis cache backend", "address", opts.Addr, "replica", id)
+
+	return nil
+}
+
+// leadCache reports whether this replica collects the cache, which it does unless the cache backend is shared
+// and another replica is the leader. The leadership lasts a cache TTL and is renewed on every call.
+func leadCache(ctx context.Context) (bool, error) {
+	elector, ok := cache.GetCache().(cache.LeaderElector)
+	if !ok {
+		return true, nil
+	}
+
+	return elector.Lead(ctx, *cacheTTL)
+}
+
+// keepLeading renews the leadership of the cache every third of the cache TTL until ctx is done, so that it does
+// not expire during a collection longer than the TTL. It cancels the collection with lost when another replica
+// took the leadership over.
+func keepLeading(ctx context.Context, lost context.CancelCauseFunc, logger *slog.Logger) {
+	if _, ok := cache.GetCache().(cache.LeaderElector); !ok {
+		return
+	}
+
+	ticker := time.NewTicker(*cacheTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			leader, err := leadCache(ctx)
+			if err != nil {
+				logger.Warn("Failed to renew the leadership, retrying", "error", err)
+				continue
+			}
+			if !leader {
+				logger.Warn("Another replica took the leadership over, stopping the collection")
+				lost(errLeadershipLost)
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// collectCacheIfLeader collects the cache, unless the cache backend is shared and another replica is the leader.
+func collectCacheIfLeader(ctx context.Context, logger *slog.Logger) error {
+	leader, err := leadCache(ctx)
+	if err != nil {
+		logger.Error("Leader election failed, skipping collection", "error", err)
+		return nil
+	}
+	if !leader {
+		logger.Debug("Another replica is the leader, serving the shared cache")
+		return nil
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go keepLeading(ctx, cancel, logger)
+
+	return collectCache(ctx, configuredServices(), logger)
+}
+
 // cacheBackgroundService runs a background service to collect the metrics and stores in the cache.
-// It collects data every cache-ttl/2 time and flush every cache-ttl time.
+// It collects each service on its refresh interval, every cache-ttl/2 time by default, and flush every cache-ttl time.
+// The first collection is waited for, the next ones run in the background.
 // The cache data will be read by the Prometheus HandleFunc.
-func cacheBackgroundService(ctx context.Context, services []string, cancel context.CancelCauseFunc, logger *slog.Logger) {
+func cacheBackgroundService(ctx context.Context, cancel context.CancelCauseFunc, logger *slog.Logger) {
 	logger.Info("Start cache background service")
-	collectTicker := time.NewTicker(*cacheTTL / 2)
+	collectTicker := time.NewTicker(cacheTick())
 	defer collectTicker.Stop()
 	ttlTicker := time.NewTicker(*cacheTTL)
 	defer ttlTicker.Stop()
 
-	// Collect cache data in the beginning.
-	if err := cache.CollectCache(exporters.EnableExporter, *multiCloud, services, *prefix, *cloud, *disabledMetrics, *endpointType, *collectTime, *disableSlowMetrics, *disableDeprecatedMetrics, *disableCinderAgentUUID, *domainID, *tenantID, novaMetadataMapping, *dnsConcurrentCount, nil, logger); err != nil {
+	// Collect cache data in the beginning. Only a configuration error stops the exporter,
+	// the clouds which fail to be collected are retried.
+	if err := collectCacheIfLeader(ctx, logger); err != nil {
 		logger.Error("Failed to collect from cache", "err", err)
 		cancel(err)
 		return
 	}
+	cacheCollected.Store(true)
 
 	for {
 		select {
 		case <-collectTicker.C:
-			if err := cache.CollectCache(exporters.EnableExporter, *multiCloud, services, *prefix, *cloud, *disabledMetrics, *endpointType, *collectTime, *disableSlowMetrics, *disableDeprecatedMetrics, *disableCinderAgentUUID, *domainID, *tenantID, novaMetadataMapping, *dnsConcurrentCount, nil, logger); err != nil {
-				cancel(err)
-				return
-			}
+			// The clouds still being collected are skipped, so the ticks are not delayed by slow clouds.
+			// The last cache is kept on failure, eg. when clouds.yaml became invalid, and the next tick retries.
+			go func() {
+				if err := collectCacheIfLeader(ctx, logger); err != nil {
+					logger.Error("Failed to collect into the cache, serving the last cache", "error", err)
+				}
+			}()
+			// The refresh intervals may have changed on reload.
+			collectTicker.Reset(cacheTick())
 		case <-ttlTicker.C:
-			cache.FlushExpiredCloudCaches(*cacheTTL)
+			cache.FlushExpiredCloudCaches(max(*cacheTTL, *cacheMaxStale))
 			logger.Info("Cache TTL flush")
 		case <-ctx.Done():
 			logger.Info("Backend service is stopping")
@@ -243,12 +643,16 @@ func cacheBackgroundService(ctx context.Context, services []string, cancel conte
 	}
 }
 
-func startHTTPServer(ctx context.Context, services []string, toolkitFlags *web.FlagConfig, cancel context.CancelCauseFunc, logger *slog.Logger) {
+func startHTTPServer(ctx context.Context, toolkitFlags *web.FlagConfig, cancel context.CancelCauseFunc, logger *slog.Logger) {
 	links := []web.LandingLinks{}
 
 	if *multiCloud {
-		http.HandleFunc("/probe", probeHandler(services, logger))
-		http.Handle(*metrics, promhttp.Handler())
+		http.Handle("/probe", traceScrapes(probeHandler(logger)))
+		http.HandleFunc("/sd", sdHandler(logger))
+		http.Handle(*metrics, promhttp.InstrumentMetricHandler(
+			prometheus.DefaultRegisterer,
+			promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: *enableOpenMetrics}),
+		))
 		logger.Info("openstack exporter started in multi cloud mode (/probe?cloud=)")
 		links = append(links, web.LandingLinks{
 			Address: *metrics,
@@ -256,16 +660,37 @@ func startHTTPServer(ctx context.Context, services []string, toolkitFlags *web.F
 		}, web.LandingLinks{
 			Address: "/probe",
 			Text:    "Probes",
+		}, web.LandingLinks{
+			Address: "/sd",
+			Text:    "Service discovery",
 		})
 	} else {
 		logger.Info("openstack exporter started in legacy mode")
-		http.HandleFunc(*metrics, metricHandler(services, logger))
+		http.Handle(*metrics, traceScrapes(metricHandler(logger)))
 		links = append(links, web.LandingLinks{
 			Address: *metrics,
 			Text:    "Metrics",
 		})
 	}
 
+	http.HandleFunc("/-/healthy", healthyHandler)
+	http.HandleFunc("/-/ready", readyHandler(logger))
+
+	if *enableLifecycle {
+		http.HandleFunc("/-/reload", reloadHandler(logger))
+	}
+
+	if *cacheEnable {
+		http.HandleFunc("/-/cache", cacheInfoHandler(logger))
+		links = append(links, web.LandingLinks{
+			Address: "/-/cache",
+			Text:    "Cache",
+		})
+		if *enableCacheRefresh {
+			http.HandleFunc("/-/cache/refresh", cacheRefreshHandler(logger))
+		}
+	}
+
 	if *metrics != "/" && *metrics != "" {
 		landingConfig := web.LandingConfig{
 			Name:        "openstack_exporter",
@@ -309,9 +734,9 @@ func startHTTPServer(ctx context.Context, services []string, toolkitFlags *web.F
 	}
 }
 
-func probeHandler(configuredServices []string, logger *slog.Logger) http.HandlerFunc {
+func probeHandler(logger *slog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx, cancel := context.WithCancel(r.Context())
+		ctx, cancel := scrapeContext(r, *scrapeTimeoutOffset, logger)
 		defer cancel()
 		r = r.WithContext(ctx)
 
@@ -321,39 +746,63 @@ func probeHandler(configuredServices []string, logger *slog.Logger) http.Handler
 			return
 		}
 
-		enabledServices, err := selectServicesForRequest(configuredServices, r)
+		enabledServices, err := selectServicesForRequest(servicesForCloud(ctx, cloud, configuredServices(), logger), r)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 		logger.Info("Enabled services", "enabled_services", enabledServices)
 
+		commonMetrics := exporters.GetCommonMetricsExporter(*prefix, cloud)
+
 		// Get data from cache
 		if *cacheEnable {
-			if err := cache.WriteCacheToResponse(w, r, cloud, enabledServices, logger); err != nil {
+			start := time.Now()
+			err := cache.WriteCacheToResponse(w, r, cloud, enabledServices, exporterMetricsGatherer(cloud), *enableOpenMetrics, logger)
+			if err != nil {
 				logger.Error("Write cache to response failed", "error", err)
 			}
+			commonMetrics.ObserveScrape(start, err)
 			return
 		}
 
-		registry := prometheus.NewPedanticRegistry()
-		for _, service := range enabledServices {
-			exp, err := exporters.EnableExporter(service, *prefix, cloud, *disabledMetrics, *endpointType, *collectTime, *disableSlowMetrics, *disableDeprecatedMetrics, *disableCinderAgentUUID, *domainID, *tenantID, novaMetadataMapping, *dnsConcurrentCount, nil, logger)
-			if err != nil {
-				logger.Error("Enabling exporter for service failed", "service", service, "error", err)
-				continue
+		// The identical probes running at the same time share one collection, which is done within the
+		// deadline of the probe starting it but goes on when that probe is cancelled.
+		collect := func(ctx context.Context) ([]*dto.MetricFamily, error) {
+			settings := cloudSettings(cloud)
+			registry := prometheus.NewPedanticRegistry()
+			unavailable := exporters.NewUnavailableServices(*prefix)
+			for _, service := range enabledServices {
+				exp, err := enableExporter(ctx, service, cloud, settings, logger)
+				if err != nil {
+					logger.Error("Enabling exporter for service failed", "service", service, "error", err)
+					commonMetrics.ScrapeErrors().Inc()
+					unavailable.Add(service, err)
+					continue
+				}
+				registry.MustRegister(*exp)
+				logger.Info("Enabled exporter for service", "service", service)
 			}
-			registry.MustRegister(*exp)
-			logger.Info("Enabled exporter for service", "service", service)
+			registry.MustRegister(unavailable)
+			return commonMetrics.InstrumentGatherer(registry).Gather()
 		}
 
-		h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+		// The exporter metrics are gathered last so that they include the outcome of this scrape.
+		gatherer := prometheus.Gatherers{
+			probeResults.gatherer(ctx, probeKey(cloud, enabledServices), *probeCacheWindow, collect),
+			exporterMetricsGatherer(cloud),
+		}
+		h := promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{EnableOpenMetrics: *enableOpenMetrics})
 		h.ServeHTTP(w, r)
 	}
 }
 
-func metricHandler(configuredServices []string, logger *slog.Logger) http.HandlerFunc {
+func metricHandler(logger *slog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := scrapeContext(r, *scrapeTimeoutOffset, logger)
+		defer cancel()
+		r = r.WithContext(ctx)
+
 		logger.Info("Starting openstack exporter version for cloud", "version", version.Info(), "cloud", *cloud)
 		logger.Info("Build context", "build_context", version.BuildContext())
 
@@ -362,41 +811,126 @@ func metricHandler(configuredServices []string, logger *slog.Logger) http.Handle
 			os.Setenv("OS_CLIENT_CONFIG_FILE", *osClientConfig)
 		}
 
-		enabledServices := configuredServices
+		enabledServices := configuredServices()
+
+		commonMetrics := exporters.GetCommonMetricsExporter(*prefix, *cloud)
 
 		// Get data from cache
 		if *cacheEnable {
-			if err := cache.WriteCacheToResponse(w, r, *cloud, enabledServices, logger); err != nil {
+			start := time.Now()
+			err := cache.WriteCacheToResponse(w, r, *cloud, enabledServices, exporterMetricsGatherer(*cloud), *enableOpenMetrics, logger)
+			if err != nil {
 				logger.Error("Write cache to response failed", "error", err)
 			}
+			commonMetrics.ObserveScrape(start, err)
 			return
 		}
 
+		settings := cloudSettings(*cloud)
 		registry := prometheus.NewPedanticRegistry()
+		unavailable := exporters.NewUnavailableServices(*prefix)
 		enabledExporters := 0
 		for _, service := range enabledServices {
-			exp, err := exporters.EnableExporter(service, *prefix, *cloud, *disabledMetrics, *endpointType, *collectTime, *disableSlowMetrics, *disableDeprecatedMetrics, *disableCinderAgentUUID, *domainID, *tenantID, novaMetadataMapping, *dnsConcurrentCount, nil, logger)
+			exp, err := enableExporter(ctx, service, *cloud, settings, logger)
 			if err != nil {
-				// Log error and continue with enabling other exporters
+				// Log error and continue with enabling other exporters, the service is reported down.
 				logger.Error("enabling exporter for service failed", "service", service, "error", err)
+				commonMetrics.ScrapeErrors().Inc()
+				unavailable.Add(service, err)
 				continue
 			}
 			registry.MustRegister(*exp)
 			logger.Info("Enabled exporter for service", "service", service)
 			enabledExporters++
 		}
+		registry.MustRegister(unavailable)
+
+		// The exporter metrics, including the program version, are gathered last so that
+		// they include the outcome of this scrape.
+		gatherer := prometheus.Gatherers{commonMetrics.InstrumentGatherer(registry), exporterMetricsGatherer(*cloud)}
+		h := promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{EnableOpenMetrics: *enableOpenMetrics})
 
+		// When no exporter could be enabled, e.g. while Keystone is down, the up metrics of the
+		// services are still returned, but the scrape is reported as failed.
 		if enabledExporters == 0 {
-			logger.Error("No exporter has been enabled, exiting")
-			os.Exit(-1)
+			logger.Error("No exporter has been enabled")
+			w = &statusResponseWriter{ResponseWriter: w, status: http.StatusServiceUnavailable}
 		}
+		h.ServeHTTP(w, r)
+	}
+}
+
+// statusResponseWriter replaces the 200 status of a response with status, other statuses are kept.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
 
+func (w *statusResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if code == http.StatusOK {
+		code = w.status
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter.
+func (w *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// exporterMetricsGatherer returns a Gatherer for the metrics about the exporter itself for a cloud.
+func exporterMetricsGatherer(cloud string) prometheus.Gatherer {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		exporters.GetCommonMetricsExporter(*prefix, cloud),
+		exporters.GetCollectorMetrics(*prefix, cloud),
+		exporters.GetAPIMetrics(*prefix, cloud),
+		exporters.NewCircuitBreakerCollector(*prefix, cloud),
 		// expose program version
-		registry.MustRegister(pver.NewCollector("openstack_exporter"))
+		pver.NewCollector("openstack_exporter"),
+	)
+	if *cacheEnable {
+		registry.MustRegister(
+			cache.NewMetricsCollector(*prefix, cloud),
+			cache.GetCollectionMetrics(*prefix, cloud),
+		)
+	}
+	return registry
+}
 
-		h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
-		h.ServeHTTP(w, r)
+// scrapeContext returns the context for collecting metrics for a request. When Prometheus sends
+// its scrape timeout, the context expires offset before it so a partial result is still returned.
+func scrapeContext(r *http.Request, offset time.Duration, logger *slog.Logger) (context.Context, context.CancelFunc) {
+	header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if header == "" {
+		return context.WithCancel(r.Context())
+	}
+
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil {
+		logger.Warn("Failed to parse scrape timeout header", "value", header, "error", err)
+		return context.WithCancel(r.Context())
 	}
+
+	timeout := time.Duration(seconds*float64(time.Second)) - offset
+	if timeout <= 0 {
+		// Keep the full scrape timeout rather than an already expired deadline.
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+
+	return context.WithTimeout(r.Context(), timeout)
 }
 
 func selectServicesForRequest(configuredServices []string, r *http.Request) ([]string, error) {
@@ -447,11 +981,11 @@ func parseServiceList(raw string) []string {
 	return services
 }
 
-func SetPasswordIfVaultIsUsed(logger *slog.Logger) {
+// SetPasswordIfVaultIsUsed sets OS_PASSWORD from the Vault secret configured in clouds.yaml, if any.
+func SetPasswordIfVaultIsUsed(logger *slog.Logger) error {
 	configFileData, err := os.ReadFile(*osClientConfig)
 	if err != nil {
-		logger.Error("failed to read config file", "err", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to read config file: %w", err)
 	}
 
 	type VaultConfig struct {
@@ -468,17 +1002,15 @@ func SetPasswordIfVaultIsUsed(logger *slog.Logger) {
 
 	err = yaml.Unmarshal(configFileData, &vaultConfig)
 	if err != nil {
-		logger.Error("failed to parse config data", "err", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to parse config data: %w", err)
 	}
 
 	if !vaultConfig.UseVault {
-		return
+		return nil
 	}
 	client, err := vault.New(vault.WithAddress(vaultConfig.VaultAddress))
 	if err != nil {
-		logger.Error("failed to create Vault client", "err", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to create Vault client: %w", err)
 	}
 	ctx := context.Background()
 	resp, err := client.Auth.AppRoleLogin(
@@ -489,12 +1021,10 @@ func SetPasswordIfVaultIsUsed(logger *slog.Logger) {
 		},
 	)
 	if err != nil {
-		logger.Error("failed to login to Vault", "err", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to login to Vault: %w", err)
 	}
 	if err := client.SetToken(resp.Auth.ClientToken); err != nil {
-		logger.Error("failed to set Vault token", "err", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to set Vault token: %w", err)
 	}
 	secret, err := client.Secrets.KvV2Read(
 		ctx,
@@ -502,9 +1032,14 @@ func SetPasswordIfVaultIsUsed(logger *slog.Logger) {
 		vault.WithMountPath(vaultConfig.VaultSecretMountPath),
 	)
 	if err != nil {
-		logger.Error("failed to get secret from Vault", "err", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to get secret from Vault: %w", err)
+	}
+
+	password, ok := secret.Data.Data[vaultConfig.CredentialNameInVaultSecret].(string)
+	if !ok {
+		return fmt.Errorf("credential %s not found in Vault secret", vaultConfig.CredentialNameInVaultSecret)
 	}
 
-	os.Setenv("OS_PASSWORD", secret.Data.Data[vaultConfig.CredentialNameInVaultSecret].(string))
+	logger.Debug("Setting OS_PASSWORD from Vault secret", "vault_secret_path", vaultConfig.VaultSecretPath)
+	return os.Setenv("OS_PASSWORD", password)
 }
@@ -1,10 +1,22 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"log/slog"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/jarcoal/httpmock"
+	"github.com/openstack-exporter/openstack-exporter/cache"
+	"github.com/openstack-exporter/openstack-exporter/config"
 	"github.com/openstack-exporter/openstack-exporter/exporters"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -95,3 +107,156 @@ func TestSelectServicesForRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestScrapeContext(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	ctx, cancel := scrapeContext(r, 500*time.Millisecond, logger)
+	defer cancel()
+	_, ok := ctx.Deadline()
+	assert.False(t, ok, "no deadline without the scrape timeout header")
+
+	r.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "10")
+	ctx, cancel = scrapeContext(r, 500*time.Millisecond, logger)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	assert.InDelta(t, 9.5, time.Until(deadline).Seconds(), 0.1)
+
+	r.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "0.2")
+	ctx, cancel = scrapeContext(r, 500*time.Millisecond, logger)
+	defer cancel()
+	deadline, ok = ctx.Deadline()
+	require.True(t, ok)
+	assert.InDelta(t, 0.2, time.Until(deadline).Seconds(), 0.1, "offset larger than the timeout is ignored")
+
+	r.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "invalid")
+	ctx, cancel = scrapeContext(r, 500*time.Millisecond, logger)
+	defer cancel()
+	_, ok = ctx.Deadline()
+	assert.False(t, ok, "invalid scrape timeout header is ignored")
+}
+
+func TestResolveServiceConfigFromFile(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	serviceStates := make(map[string]serviceState, len(exporters.SupportedExporters))
+	for _, service := range exporters.SupportedExporters {
+		serviceStates[service] = serviceAuto
+	}
+	serviceStates["network"] = serviceDisabled
+
+	services, err := resolveServiceConfig(false, "test.cloud", false, serviceStates, []string{"compute", "network"}, logger)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"compute"}, services)
+}
+
+func TestCloudServices(t *testing.T) {
+	cfg, err := config.Parse([]byte("clouds: {lab: {services: [compute]}}"))
+	require.NoError(t, err)
+	exporterConfig.Store(cfg)
+	t.Cleanup(func() { exporterConfig.Store(nil) })
+
+	configured := []string{"compute", "network"}
+	assert.Equal(t, []string{"compute"}, cloudServices("lab", configured))
+	assert.Equal(t, configured, cloudServices("prod", configured))
+}
+
+func TestCloudServicesDisabledByFlag(t *testing.T) {
+	cfg, err := config.Parse([]byte("clouds: {lab: {services: [compute, network, volume]}}"))
+	require.NoError(t, err)
+	exporterConfig.Store(cfg)
+	previousStates := flagServiceStates
+	t.Cleanup(func() {
+		exporterConfig.Store(nil)
+		flagServiceStates = previousStates
+	})
+
+	// --disable-service.network and --no-disable-service.image.
+	flagServiceStates = map[string]serviceState{"network": serviceDisabled, "image": serviceEnabled}
+	assert.Equal(t, []string{"compute", "image", "volume"}, cloudServices("lab", []string{"compute"}))
+}
+
+func TestServicesForCloudWithoutAutodetection(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	previousMultiCloud, previousDisable := *multiCloud, *disableServiceAutodetect
+	t.Cleanup(func() {
+		*multiCloud, *disableServiceAutodetect = previousMultiCloud, previousDisable
+		exporterConfig.Store(nil)
+	})
+
+	configured := []string{"compute", "network"}
+
+	// Single cloud services were autodetected at startup.
+	*multiCloud, *disableServiceAutodetect = false, false
+	assert.Equal(t, configured, servicesForCloud(context.Background(), "prod", configured, logger))
+
+	*multiCloud, *disableServiceAutodetect = true, true
+	assert.Equal(t, configured, servicesForCloud(context.Background(), "prod", configured, logger))
+
+	// Services of the configuration file replace autodetection.
+	*disableServiceAutodetect = false
+	cfg, err := config.Parse([]byte("clouds: {lab: {services: [compute]}}"))
+	require.NoError(t, err)
+	exporterConfig.Store(cfg)
+	assert.Equal(t, []string{"compute"}, servicesForCloud(context.Background(), "lab", configured, logger))
+}
+
+func TestServicesForCloudAutodetection(t *testing.T) {
+	setupReadyTest(t)
+	logger := slog.New(slog.DiscardHandler)
+	previousDisable, previousEndpointType := *disableServiceAutodetect, *endpointType
+	*multiCloud, *disableServiceAutodetect, *endpointType = true, false, "public"
+	t.Cleanup(func() {
+		*disableServiceAutodetect, *endpointType = previousDisable, previousEndpointType
+		exporterConfig.Store(nil)
+		exporters.GetServiceAutodetector().InvalidateAll()
+	})
+	exporters.GetServiceAutodetector().InvalidateAll()
+
+	// Drop the volume service from the catalog.
+	var tokens map[string]any
+	data, err := os.ReadFile("exporters/fixtures/tokens.json")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &tokens))
+	token := tokens["token"].(map[string]any)
+	token["catalog"] = slices.DeleteFunc(token["catalog"].([]any), func(entry any) bool {
+		return entry.(map[string]any)["type"] == "volumev3"
+	})
+	data, err = json.Marshal(tokens)
+	require.NoError(t, err)
+	httpmock.RegisterResponder("POST", "http://test.cloud:35357/v3/auth/tokens",
+		httpmock.NewBytesResponder(201, data).HeaderSet(map[string][]string{"X-Subject-Token": {"1234"}}))
+	httpmock.RegisterResponder("GET", "http://test.cloud:35357/v3/auth/tokens",
+		httpmock.NewBytesResponder(200, data).HeaderSet(map[string][]string{"X-Subject-Token": {"1234"}}))
+
+	// The services set for all clouds are intersected with the catalog, which has no volume service.
+	cfg, err := config.Parse([]byte("services: [compute, volume]\nclouds: {lab: {services: [compute, volume]}}"))
+	require.NoError(t, err)
+	exporterConfig.Store(cfg)
+	assert.Equal(t, []string{"compute"}, servicesForCloud(context.Background(), "test.cloud", []string{"compute", "volume"}, logger))
+
+	// The services set for the cloud itself are kept as is.
+	assert.Equal(t, []string{"compute", "volume"}, servicesForCloud(context.Background(), "lab", []string{"compute", "volume"}, logger))
+}
+
+func TestCollectCacheInvalidCloudsYAML(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	previousMultiCloud, previousPrefix, previousSchedule := *multiCloud, *prefix, collectSchedule
+	t.Cleanup(func() { *multiCloud, *prefix, collectSchedule = previousMultiCloud, previousPrefix, previousSchedule })
+	*multiCloud, *prefix = true, "test_invalid_clouds"
+	collectSchedule = newCacheSchedule(1)
+	collectSchedule.setClouds([]string{"prod"})
+
+	cloudsFile := filepath.Join(t.TempDir(), "clouds.yaml")
+	require.NoError(t, os.WriteFile(cloudsFile, []byte("clouds: [invalid"), 0o600))
+	t.Setenv("OS_CLIENT_CONFIG_FILE", cloudsFile)
+
+	require.Error(t, collectCache(context.Background(), []string{"compute"}, logger))
+	assert.Equal(t, []string{"prod"}, collectSchedule.lastClouds())
+	require.NoError(t, testutil.CollectAndCompare(cache.GetCollectionMetrics(*prefix, "prod"), strings.NewReader(`
+# HELP test_invalid_clouds_exporter_cache_collection_failures_total Total number of failed collections of the cloud into the cache
+# TYPE test_invalid_clouds_exporter_cache_collection_failures_total counter
+test_invalid_clouds_exporter_cache_collection_failures_total{cloud="prod"} 1
+`), "test_invalid_clouds_exporter_cache_collection_failures_total"))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openstack-exporter/openstack-exporter/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/sync/singleflight"
+)
+
+// probeCollectTimeout bounds a collection started by a probe without a deadline, e.g. from a client other than
+// Prometheus, which sends its scrape timeout.
+const probeCollectTimeout = 2 * time.Minute
+
+// probeResults shares the collections of the identical probes of /probe.
+var probeResults = newProbeGatherer()
+
+// probeGatherer shares a collection between the concurrent identical probes, e.g. of Prometheus HA replicas,
+// and optionally keeps its result for a short window to serve the probes arriving right after it.
+type probeGatherer struct {
+	group   singleflight.Group
+	timeout time.Duration
+	mu      sync.Mutex
+	results map[string]probeResult
+}
+
+type probeResult struct {
+	metricFamilies []*dto.MetricFamily
+	err            error
+	time           time.Time
+}
+
+func newProbeGatherer() *probeGatherer {
+	return &probeGatherer{timeout: probeCollectTimeout, results: make(map[string]probeResult)}
+}
+
+// probeKey identifies the probes collecting the same services of cloud.
+func probeKey(cloud string, services []string) string {
+	return cloud + "\x00" + strings.Join(slices.Sorted(slices.Values(services)), ",")
+}
+
+// gatherer returns a Gatherer running collect once for all the concurrent calls with the same key. The result
+// is reused by the calls within window after it, none when window is 0. The metric families returned
+// are shared, so they must not be modified.
+//
+// The collection is not cancelled with the ctx of the call starting it, so that it keeps running for the
+// other calls, but it ends at the deadline of ctx, or after the timeout of p when ctx has none. Each call stops waiting for it when its own ctx is done,
+// and the result of a collection whose deadline was exceeded is not reused.
+func (p *probeGatherer) gatherer(ctx context.Context, key string, window time.Duration, collect func(ctx context.Context) ([]*dto.MetricFamily, error)) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		if result, ok := p.recent(key, window); ok {
+			return result.metricFamilies, result.err
+		}
+
+		ch := p.group.DoChan(key, func() (any, error) {
+			collectCtx, cancel := utils.DetachContext(ctx, p.timeout)
+			defer cancel()
+
+			metricFamilies, err := collect(collectCtx)
+			result := probeResult{metricFamilies: metricFamilies, err: err, time: time.Now()}
+			if window > 0 && collectCtx.Err() == nil {
+				p.store(key, result, window)
+			}
+			return result, nil
+		})
+
+		select {
+		case res := <-ch:
+			result := res.Val.(probeResult)
+			return result.metricFamilies, result.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+}
+
+// recent returns the result stored for key if it is younger than window.
+func (p *probeGatherer) recent(key string, window time.Duration) (probeResult, bool) {
+	if window <= 0 {
+		return probeResult{}, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result, ok := p.results[key]
+	if !ok || time.Since(result.time) >= window {
+		return probeResult{}, false
+	}
+
+	return result, true
+}
+
+// store keeps result for key, and drops the results older than window.
+func (p *probeGatherer) store(key string, result probeResult, window time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for k, r := range p.results {
+		if time.Since(r.time) >= window {
+			delete(p.results, k)
+		}
+	}
+	p.results[key] = result
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingCollect counts its collections, each waiting for release.
+func countingCollect(calls *atomic.Int32, release <-chan struct{}) func(context.Context) ([]*dto.MetricFamily, error) {
+	return func(ctx context.Context) ([]*dto.MetricFamily, error) {
+		calls.Add(1)
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		name := "up"
+		return []*dto.MetricFamily{{Name: &name}}, nil
+	}
+}
+
+func TestProbeKey(t *testing.T) {
+	assert.Equal(t, probeKey("prod", []string{"network", "compute"}), probeKey("prod", []string{"compute", "network"}))
+	assert.NotEqual(t, probeKey("prod", []string{"compute"}), probeKey("prod", []string{"compute", "network"}))
+	assert.NotEqual(t, probeKey("prod", []string{"compute"}), probeKey("lab", []string{"compute"}))
+}
+
+func TestProbeGathererConcurrent(t *testing.T) {
+	p := newProbeGatherer()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	g := p.gatherer(context.Background(), "prod", 0, countingCollect(&calls, release))
+
+	var wg sync.WaitGroup
+	results := make([][]*dto.MetricFamily, 5)
+	for i := range results {
+		wg.Go(func() {
+			mfs, err := g.Gather()
+			assert.NoError(t, err)
+			results[i] = mfs
+		})
+	}
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+	// Let the other probes join the collection in flight.
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	for _, mfs := range results {
+		assert.Len(t, mfs, 1)
+	}
+
+	// Without a window, the next probe collects again.
+	_, err := g.Gather()
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestProbeGathererWindow(t *testing.T) {
+	p := newProbeGatherer()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	close(release)
+
+	g := p.gatherer(context.Background(), "prod", 50*time.Millisecond, countingCollect(&calls, release))
+	for range 3 {
+		_, err := g.Gather()
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), calls.Load())
+
+	// Other probes are not served the result.
+	_, err := p.gatherer(context.Background(), "lab", 50*time.Millisecond, countingCollect(&calls, release)).Gather()
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = g.Gather()
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestProbeGathererCancelled(t *testing.T) {
+	p := newProbeGatherer()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	collect := countingCollect(&calls, release)
+
+	// The probe starting the collection gives up, the collection goes on for the other probe.
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := p.gatherer(ctx, "prod", time.Minute, collect).Gather()
+		first <- err
+	}()
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+	second := make(chan error)
+	go func() {
+		_, err := p.gatherer(context.Background(), "prod", time.Minute, collect).Gather()
+		second <- err
+	}()
+	cancel()
+	assert.ErrorIs(t, <-first, context.Canceled)
+	close(release)
+	require.NoError(t, <-second)
+	assert.Equal(t, int32(1), calls.Load())
+
+	// The result of a collection past its deadline is not reused.
+	blocked := countingCollect(&calls, make(chan struct{}))
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := p.gatherer(ctx, "lab", time.Minute, blocked).Gather()
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	_, ok := p.recent("lab", time.Minute)
+	assert.False(t, ok)
+}
+
+func TestProbeGathererTimeout(t *testing.T) {
+	p := newProbeGatherer()
+	p.timeout = 20 * time.Millisecond
+	var calls atomic.Int32
+
+	// A probe without a deadline does not leave its collection running forever.
+	done := make(chan error)
+	go func() {
+		_, err := p.gatherer(context.Background(), "prod", time.Minute, countingCollect(&calls, make(chan struct{}))).Gather()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(time.Second):
+		t.Fatal("the collection of a probe without a deadline did not time out")
+	}
+	_, ok := p.recent("prod", time.Minute)
+	assert.False(t, ok)
+}
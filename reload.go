@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/openstack-exporter/openstack-exporter/config"
+	"github.com/openstack-exporter/openstack-exporter/exporters"
+)
+
+// reloadDelay groups the file events of an update, e.g. of a Kubernetes ConfigMap, into one reload.
+const reloadDelay = 1 * time.Second
+
+var (
+	// flagServiceStates are the service states set by the --disable-service.<service> flags.
+	flagServiceStates map[string]serviceState
+	// enabledServices are the services resolved by the last successful load.
+	enabledServices atomic.Pointer[[]string]
+	reloadMu        sync.Mutex
+)
+
+// configuredServices returns the services to scrape.
+func configuredServices() []string {
+	return *enabledServices.Load()
+}
+
+// reload reads clouds.yaml and the configuration file and resolves the services to scrape.
+// On error the previous configuration is kept. Scrapes in progress finish with the
+// clients they started with, the next ones authenticate again.
+func reload(logger *slog.Logger) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	if err := SetPasswordIfVaultIsUsed(logger); err != nil {
+		return err
+	}
+
+	cloudsYAML, err := os.ReadFile(*osClientConfig)
+	if err != nil {
+		return fmt.Errorf("could not read clouds.yaml: %w", err)
+	}
+
+	var cfg *config.Config
+	if *configFile != "" {
+		var err error
+		cfg, err = config.Load(*configFile)
+		if err != nil {
+			return fmt.Errorf("could not load configuration file: %w", err)
+		}
+	}
+
+	services, err := resolveServiceConfig(*multiCloud, *cloud, *disableServiceAutodetect, maps.Clone(flagServiceStates), cfg.ForCloud(*cloud).Services, logger)
+	if err != nil {
+		return fmt.Errorf("failed to resolve service configuration: %w", err)
+	}
+
+	if enabledServices.Load() != nil && cfg != nil && cfg.CacheTTL != nil && *cfg.CacheTTL != *cacheTTL {
+		logger.Warn("Changes of cache_ttl are only applied on restart", "cache_ttl", *cacheTTL)
+	}
+
+	exporterConfig.Store(cfg)
+	enabledServices.Store(&services)
+	// The password read from Vault completes clouds.yaml, the clients authenticate again when it changes.
+	exporters.GetClientPool().Reload(append(cloudsYAML, os.Getenv("OS_PASSWORD")...), logger)
+	exporters.GetServiceAutodetector().InvalidateAll()
+
+	return nil
+}
+
+// reloadAndLog reloads the configuration and logs the outcome.
+func reloadAndLog(trigger string, logger *slog.Logger) error {
+	logger.Info("Reloading configuration", "trigger", trigger)
+	if err := reload(logger); err != nil {
+		logger.Error("Failed to reload configuration, keeping the previous one", "trigger", trigger, "error", err)
+		return err
+	}
+
+	logger.Info("Configuration reloaded", "trigger", trigger, "enabled_services", configuredServices())
+	return nil
+}
+
+// reloadOnSignal reloads the configuration on every SIGHUP until ctx is done.
+func reloadOnSignal(ctx context.Context, logger *slog.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-hup:
+			_ = reloadAndLog("SIGHUP", logger)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reloadHandler reloads the configuration on POST or PUT requests.
+func reloadHandler(logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut {
+			w.Header().Set("Allow", "POST, PUT")
+			http.Error(w, "Only POST or PUT requests allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := reloadAndLog("HTTP", logger); err != nil {
+			http.Error(w, fmt.Sprintf("failed to reload configuration: %s", err), http.StatusInternalServerError)
+		}
+	}
+}
+
+// watchConfigFiles reloads the configuration when one of files changes, until ctx is done.
+// The parent directories are watched, so that files replaced by a rename, as editors and
+// Kubernetes do, are still followed.
+func watchConfigFiles(ctx context.Context, files []string, logger *slog.Logger) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	watched := make(map[string]bool, len(files))
+	for _, file := range files {
+		file, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		watched[file] = true
+
+		dir := filepath.Dir(file)
+		if !slices.Contains(watcher.WatchList(), dir) {
+			if err := watcher.Add(dir); err != nil {
+				return fmt.Errorf("failed to watch %s: %w", dir, err)
+			}
+		}
+	}
+
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// Kubernetes swaps the ..data symlink of the volume when a ConfigMap or Secret is updated.
+			if watched[event.Name] || filepath.Base(event.Name) == "..data" {
+				logger.Debug("Configuration file changed", "file", event.Name, "op", event.Op.String())
+				timer.Reset(reloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Error("Configuration file watcher failed", "error", err)
+		case <-timer.C:
+			_ = reloadAndLog("file change", logger)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/openstack-exporter/openstack-exporter/exporters"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupReloadTest points the flags to temporary clouds.yaml and configuration files in multi cloud mode,
+// so that no autodetection is needed, and returns the path of the configuration file.
+func setupReloadTest(t *testing.T) string {
+	dir := t.TempDir()
+	cloudsFile := path.Join(dir, "clouds.yaml")
+	require.NoError(t, os.WriteFile(cloudsFile, []byte("clouds: {}\n"), 0o600))
+	file := path.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("services: [compute, network]\n"), 0o600))
+
+	previousClientConfig, previousConfigFile, previousMultiCloud := *osClientConfig, *configFile, *multiCloud
+	*osClientConfig, *configFile, *multiCloud = cloudsFile, file, true
+
+	flagServiceStates = make(map[string]serviceState, len(exporters.SupportedExporters))
+	for _, service := range exporters.SupportedExporters {
+		flagServiceStates[service] = serviceAuto
+	}
+
+	t.Cleanup(func() {
+		*osClientConfig, *configFile, *multiCloud = previousClientConfig, previousConfigFile, previousMultiCloud
+		exporterConfig.Store(nil)
+		enabledServices.Store(nil)
+	})
+
+	return file
+}
+
+func TestReload(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	file := setupReloadTest(t)
+
+	require.NoError(t, reload(logger))
+	assert.ElementsMatch(t, []string{"compute", "network"}, configuredServices())
+
+	require.NoError(t, os.WriteFile(file, []byte("services: [compute]\ndomain_id: default\n"), 0o600))
+	require.NoError(t, reload(logger))
+	assert.Equal(t, []string{"compute"}, configuredServices())
+	assert.Equal(t, "default", *exporterConfig.Load().DomainID)
+
+	// An invalid configuration keeps the previous one.
+	require.NoError(t, os.WriteFile(file, []byte("services: [nope]\n"), 0o600))
+	assert.Error(t, reload(logger))
+	assert.Equal(t, []string{"compute"}, configuredServices())
+	assert.Equal(t, "default", *exporterConfig.Load().DomainID)
+}
+
+func TestReloadHandler(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	file := setupReloadTest(t)
+	require.NoError(t, reload(logger))
+
+	handler := reloadHandler(logger)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/-/reload", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	require.NoError(t, os.WriteFile(file, []byte("services: [volume]\n"), 0o600))
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []string{"volume"}, configuredServices())
+
+	require.NoError(t, os.WriteFile(file, []byte("unknown: true\n"), 0o600))
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, []string{"volume"}, configuredServices())
+}
+
+func TestWatchConfigFiles(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	file := setupReloadTest(t)
+	require.NoError(t, reload(logger))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- watchConfigFiles(ctx, []string{file}, logger)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-done)
+	})
+
+	// Replace the file by a rename, as editors and Kubernetes do.
+	update := file + ".new"
+	assert.Eventually(t, func() bool {
+		if err := os.WriteFile(update, []byte("services: [image]\n"), 0o600); err != nil {
+			return false
+		}
+		if err := os.Rename(update, file); err != nil {
+			return false
+		}
+		time.Sleep(reloadDelay + 500*time.Millisecond)
+		return len(configuredServices()) == 1 && configuredServices()[0] == "image"
+	}, 10*time.Second, 100*time.Millisecond)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/openstack-exporter/openstack-exporter/cache"
+	"golang.org/x/sync/semaphore"
+)
+
+// collectSchedule is the schedule of the cache background service.
+var collectSchedule = newCacheSchedule(1)
+
+// cacheSchedule remembers when the services of each cloud were last collected into the cache,
+// so that every service is collected again only once its refresh interval has passed.
+// It also tracks the clouds being collected, and bounds how many are collected at the same time.
+type cacheSchedule struct {
+	mu        sync.Mutex
+	collected map[cacheScheduleKey]time.Time
+	errors    map[cacheScheduleKey]serviceError
+	running   map[string]bool
+	clouds    []string
+	slots     *semaphore.Weighted
+}
+
+// serviceError is the last error of the collection of a service into the cache.
+type serviceError struct {
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+}
+
+type cacheScheduleKey struct {
+	cloud   string
+	service string
+}
+
+// newCacheSchedule returns a cacheSchedule collecting up to concurrency clouds at the same time.
+func newCacheSchedule(concurrency int) *cacheSchedule {
+	return &cacheSchedule{
+		collected: make(map[cacheScheduleKey]time.Time),
+		errors:    make(map[cacheScheduleKey]serviceError),
+		running:   make(map[string]bool),
+		slots:     semaphore.NewWeighted(int64(max(concurrency, 1))),
+	}
+}
+
+// start marks cloud as being collected, it returns false if it already is.
+func (s *cacheSchedule) start(cloud string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running[cloud] {
+		return false
+	}
+	s.running[cloud] = true
+
+	return true
+}
+
+// finish marks cloud as no longer being collected.
+func (s *cacheSchedule) finish(cloud string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.running, cloud)
+}
+
+// setClouds records the clouds of the last valid configuration.
+func (s *cacheSchedule) setClouds(clouds []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clouds = clouds
+}
+
+// lastClouds returns the clouds of the last valid configuration.
+func (s *cacheSchedule) lastClouds() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.clouds
+}
+
+// acquire waits for a cloud collection slot, release must be called when done.
+func (s *cacheSchedule) acquire(ctx context.Context) error {
+	return s.slots.Acquire(ctx, 1)
+}
+
+// release frees a slot taken by acquire.
+func (s *cacheSchedule) release() {
+	s.slots.Release(1)
+}
+
+// due splits the services of cloud into the ones to collect at now and the ones to keep in the cache.
+// A service is due when it will have reached its interval before the next tick is half over, so that
+// the jitter of the ticks does not delay it by a whole tick.
+func (s *cacheSchedule) due(cloud string, services []string, interval func(service string) time.Duration, now time.Time, tick time.Duration) (due, later []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, service := range services {
+		last, ok := s.collected[cacheScheduleKey{cloud, service}]
+		if !ok || now.Sub(last)+tick/2 >= interval(service) {
+			due = append(due, service)
+		} else {
+			later = append(later, service)
+		}
+	}
+
+	return due, later
+}
+
+// done records that the services of cloud were successfully collected at now.
+func (s *cacheSchedule) done(cloud string, services []string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, service := range services {
+		s.collected[cacheScheduleKey{cloud, service}] = now
+		delete(s.errors, cacheScheduleKey{cloud, service})
+	}
+}
+
+// failed records the errors of the services of cloud which failed to be collected at now.
+// The services stay due, so that they are collected again.
+func (s *cacheSchedule) failed(cloud string, serviceErrors cache.ServiceErrors, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for service, err := range serviceErrors {
+		s.errors[cacheScheduleKey{cloud, service}] = serviceError{Error: err.Error(), Time: now}
+	}
+}
+
+// lastErrors returns the errors of the services of cloud whose last collection failed.
+func (s *cacheSchedule) lastErrors(cloud string) map[string]serviceError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lastErrors := make(map[string]serviceError)
+	for key, err := range s.errors {
+		if key.cloud == cloud {
+			lastErrors[key.service] = err
+		}
+	}
+
+	return lastErrors
+}
+
+// refreshInterval returns how often service is collected into the cache for cloud, half the cache TTL by default.
+func refreshInterval(cloud, service string) time.Duration {
+	if interval, ok := exporterConfig.Load().ForCloud(cloud).RefreshIntervals[service]; ok {
+		return interval
+	}
+
+	return *cacheTTL / 2
+}
+
+// cacheTick returns how often the cache background service checks for services to collect:
+// half the cache TTL, or the shortest refresh interval of the configuration file.
+func cacheTick() time.Duration {
+	tick := *cacheTTL / 2
+
+	cfg := exporterConfig.Load()
+	if cfg == nil {
+		return tick
+	}
+	for _, interval := range cfg.RefreshIntervals {
+		tick = min(tick, interval)
+	}
+	for _, settings := range cfg.Clouds {
+		for _, interval := range settings.RefreshIntervals {
+			tick = min(tick, interval)
+		}
+	}
+
+	return tick
+}
+
+// backoffDelay returns the delay before the retry following attempt, counting from 0:
+// backoff doubled on every attempt, with a jitter of 20% so that the clouds failing together are not retried together.
+func backoffDelay(backoff time.Duration, attempt int) time.Duration {
+	delay := backoff << min(attempt, 16)
+	jitter := time.Duration((rand.Float64()*0.4 - 0.2) * float64(delay))
+
+	return delay + jitter
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/openstack-exporter/openstack-exporter/cache"
+	"github.com/openstack-exporter/openstack-exporter/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheScheduleDue(t *testing.T) {
+	schedule := newCacheSchedule(1)
+	intervals := map[string]time.Duration{"compute": 30 * time.Second, "identity": time.Hour}
+	interval := func(service string) time.Duration { return intervals[service] }
+	services := []string{"compute", "identity"}
+	start := time.Now()
+
+	due, later := schedule.due("prod", services, interval, start, 30*time.Second)
+	assert.Equal(t, services, due)
+	assert.Empty(t, later)
+	schedule.done("prod", due, start)
+
+	// A tick slightly early still collects the service due on it.
+	due, later = schedule.due("prod", services, interval, start.Add(29*time.Second), 30*time.Second)
+	assert.Equal(t, []string{"compute"}, due)
+	assert.Equal(t, []string{"identity"}, later)
+
+	// Clouds are scheduled independently.
+	due, _ = schedule.due("lab", services, interval, start.Add(time.Second), 30*time.Second)
+	assert.Equal(t, services, due)
+}
+
+func TestCacheScheduleRunning(t *testing.T) {
+	schedule := newCacheSchedule(1)
+
+	assert.True(t, schedule.start("prod"))
+	assert.False(t, schedule.start("prod"), "a cloud must not be collected twice at the same time")
+	assert.True(t, schedule.start("lab"))
+	schedule.finish("prod")
+	assert.True(t, schedule.start("prod"))
+
+	require.NoError(t, schedule.acquire(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Error(t, schedule.acquire(ctx), "only one cloud can be collected at the same time")
+	schedule.release()
+	require.NoError(t, schedule.acquire(context.Background()))
+	schedule.release()
+}
+
+func TestCacheTick(t *testing.T) {
+	previousTTL := *cacheTTL
+	*cacheTTL = 10 * time.Minute
+	t.Cleanup(func() {
+		*cacheTTL = previousTTL
+		exporterConfig.Store(nil)
+	})
+
+	assert.Equal(t, 5*time.Minute, cacheTick())
+	assert.Equal(t, 5*time.Minute, refreshInterval("prod", "compute"))
+
+	cfg, err := config.Parse([]byte("refresh_intervals: {identity: 1h}\nclouds: {prod: {refresh_intervals: {compute: 30s}}}"))
+	require.NoError(t, err)
+	exporterConfig.Store(cfg)
+
+	assert.Equal(t, 30*time.Second, cacheTick())
+	assert.Equal(t, 30*time.Second, refreshInterval("prod", "compute"))
+	assert.Equal(t, 5*time.Minute, refreshInterval("lab", "compute"))
+	assert.Equal(t, time.Hour, refreshInterval("lab", "identity"))
+}
+
+func TestBackoffDelay(t *testing.T) {
+	for attempt, expected := range []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second} {
+		delay := backoffDelay(5*time.Second, attempt)
+		assert.GreaterOrEqual(t, delay, expected*8/10)
+		assert.LessOrEqual(t, delay, expected*12/10)
+	}
+}
+
+func TestCacheScheduleErrors(t *testing.T) {
+	s := newCacheSchedule(1)
+	now := time.Now()
+	interval := func(string) time.Duration { return time.Hour }
+
+	s.done("prod", []string{"compute"}, now)
+	s.failed("prod", cache.ServiceErrors{"network": errors.New("timeout")}, now)
+	assert.Equal(t, map[string]serviceError{"network": {Error: "timeout", Time: now}}, s.lastErrors("prod"))
+	assert.Empty(t, s.lastErrors("lab"))
+
+	due, _ := s.due("prod", []string{"compute", "network"}, interval, now, time.Minute)
+	assert.Equal(t, []string{"network"}, due)
+
+	s.done("prod", []string{"network"}, now)
+	assert.Empty(t, s.lastErrors("prod"))
+	due, _ = s.due("prod", []string{"compute", "network"}, interval, now, time.Minute)
+	assert.Empty(t, due)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	clientconfigv2 "github.com/gophercloud/utils/v2/openstack/clientconfig"
+	"golang.org/x/sync/errgroup"
+)
+
+// cloudConcurrency is the number of clouds handled at the same time by /sd and /-/ready.
+const cloudConcurrency = 10
+
+// sdMetaPrefix is the prefix of the meta labels of the target groups returned by /sd.
+const sdMetaPrefix = "__meta_openstack_exporter_"
+
+// targetGroup is a target group of the Prometheus HTTP service discovery.
+type targetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// sdHandler returns one target group per cloud of clouds.yaml in the Prometheus http_sd format.
+// The target is the exporter itself, as reached by the request, so that each cloud is scraped on /probe.
+func sdHandler(logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clouds, err := clientconfigv2.LoadCloudsYAML()
+		if err != nil {
+			logger.Error("Failed to load clouds.yaml for service discovery", "error", err)
+			http.Error(w, "failed to load clouds.yaml", http.StatusInternalServerError)
+			return
+		}
+
+		names := slices.Sorted(maps.Keys(clouds))
+		groups := make([]targetGroup, len(names))
+
+		var g errgroup.Group
+		g.SetLimit(cloudConcurrency)
+		for i, name := range names {
+			g.Go(func() error {
+				services := servicesForCloud(r.Context(), name, configuredServices(), logger)
+				groups[i] = cloudTargetGroup(r.Host, name, clouds[name], services)
+				return nil
+			})
+		}
+		_ = g.Wait()
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(groups); err != nil {
+			logger.Error("Failed to write service discovery response", "error", err)
+		}
+	}
+}
+
+// cloudTargetGroup returns the target group scraping cloud through the exporter at target.
+func cloudTargetGroup(target, name string, cloud clientconfigv2.Cloud, services []string) targetGroup {
+	labels := map[string]string{
+		"__metrics_path__":      "/probe",
+		"__param_cloud":         name,
+		sdMetaPrefix + "cloud":  name,
+		sdMetaPrefix + "region": cloud.RegionName,
+	}
+
+	// Lists are joined with leading and trailing commas, as the meta labels of Prometheus do.
+	labels[sdMetaPrefix+"services"] = ""
+	if len(services) > 0 {
+		labels[sdMetaPrefix+"services"] = "," + strings.Join(services, ",") + ","
+	}
+
+	if cloud.AuthInfo != nil {
+		if authURL, err := url.Parse(cloud.AuthInfo.AuthURL); err == nil {
+			labels[sdMetaPrefix+"auth_host"] = authURL.Hostname()
+		}
+	}
+
+	return targetGroup{
+		Targets: []string{target},
+		Labels:  labels,
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sdCloudsYAML = `
+clouds:
+  prod:
+    region_name: RegionOne
+    auth:
+      auth_url: https://keystone.prod.example.com:5000/v3
+  lab:
+    auth:
+      auth_url: http://10.0.0.1/identity
+`
+
+func TestSDHandler(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	setupReloadTest(t)
+
+	cloudsFile := path.Join(t.TempDir(), "clouds.yaml")
+	require.NoError(t, os.WriteFile(cloudsFile, []byte(sdCloudsYAML), 0o600))
+	t.Setenv("OS_CLIENT_CONFIG_FILE", cloudsFile)
+
+	previousDisable := *disableServiceAutodetect
+	*disableServiceAutodetect = true
+	t.Cleanup(func() { *disableServiceAutodetect = previousDisable })
+	require.NoError(t, reload(logger))
+
+	rr := httptest.NewRecorder()
+	sdHandler(logger)(rr, httptest.NewRequest(http.MethodGet, "http://exporter:9180/sd", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var groups []targetGroup
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &groups))
+	assert.Equal(t, []targetGroup{
+		{
+			Targets: []string{"exporter:9180"},
+			Labels: map[string]string{
+				"__metrics_path__":                    "/probe",
+				"__param_cloud":                       "lab",
+				"__meta_openstack_exporter_cloud":     "lab",
+				"__meta_openstack_exporter_region":    "",
+				"__meta_openstack_exporter_auth_host": "10.0.0.1",
+				"__meta_openstack_exporter_services":  ",network,compute,",
+			},
+		},
+		{
+			Targets: []string{"exporter:9180"},
+			Labels: map[string]string{
+				"__metrics_path__":                    "/probe",
+				"__param_cloud":                       "prod",
+				"__meta_openstack_exporter_cloud":     "prod",
+				"__meta_openstack_exporter_region":    "RegionOne",
+				"__meta_openstack_exporter_auth_host": "keystone.prod.example.com",
+				"__meta_openstack_exporter_services":  ",network,compute,",
+			},
+		},
+	}, groups)
+}
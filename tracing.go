@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/prometheus/common/version"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// tracer creates the spans of the cache collections.
+var tracer = otel.Tracer("github.com/openstack-exporter/openstack-exporter")
+
+// setupTracing exports the spans to the OTLP HTTP endpoint of --tracing.otlp-endpoint, tracing stays
+// disabled when it is not set. The returned function flushes the pending spans and stops the export.
+func setupTracing(ctx context.Context, logger *slog.Logger) (func(context.Context) error, error) {
+	if *tracingEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(*tracingEndpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(*tracingSamplingRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "openstack-exporter"),
+			attribute.String("service.version", version.Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	logger.Info("Exporting traces", "endpoint", *tracingEndpoint, "sampling_ratio", *tracingSamplingRatio)
+
+	return provider.Shutdown, nil
+}
+
+// traceScrapes makes every request of handler the root span of its trace, unless the scraper sent
+// the context of its own trace.
+func traceScrapes(handler http.Handler) http.Handler {
+	return otelhttp.NewHandler(handler, "scrape")
+}
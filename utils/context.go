@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"context"
+	"time"
+)
+
+// DetachContext returns a context carrying the values of ctx but not cancelled with it, for work shared with other
+// callers. It ends at the deadline of ctx, or after fallback when ctx has none.
+func DetachContext(ctx context.Context, fallback time.Duration) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(fallback)
+	}
+
+	return context.WithDeadline(context.WithoutCancel(ctx), deadline)
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetachContext(t *testing.T) {
+	parent, cancel := context.WithTimeout(context.Background(), time.Hour)
+	deadline, _ := parent.Deadline()
+	ctx, cancelDetached := DetachContext(parent, time.Minute)
+	defer cancelDetached()
+	cancel()
+
+	assert.NoError(t, ctx.Err(), "the detached context is not cancelled with its parent")
+	detachedDeadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.Equal(t, deadline, detachedDeadline)
+
+	ctx, cancelDetached = DetachContext(context.Background(), time.Minute)
+	defer cancelDetached()
+	detachedDeadline, ok = ctx.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), detachedDeadline, time.Second)
+}
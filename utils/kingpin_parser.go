@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/alecthomas/kingpin/v2"
+	"gopkg.in/yaml.v3"
 )
 
 var (
@@ -87,6 +88,25 @@ func (s *LabelMappingFlag) IsCumulative() bool {
 	return true
 }
 
+// UnmarshalYAML accepts the same mappings as the flag, either as one string or as a list of strings.
+func (s *LabelMappingFlag) UnmarshalYAML(value *yaml.Node) error {
+	var mappings []string
+	if value.Kind == yaml.ScalarNode {
+		mappings = []string{value.Value}
+	} else if err := value.Decode(&mappings); err != nil {
+		return err
+	}
+
+	*s = LabelMappingFlag{}
+	for _, mapping := range mappings {
+		if err := s.Set(mapping); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (s *LabelMappingFlag) Extract(m map[string]string) []string {
 	ret := make([]string, 0, len(s.Keys))
 	for _, key := range s.Keys {
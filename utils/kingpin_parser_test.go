@@ -6,6 +6,7 @@ import (
 
 	assertpkg "github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 )
 
 func TestLabelMappingFlag_Set(t *testing.T) {
@@ -66,3 +67,19 @@ func TestLabelMappingFlag_Extract(t *testing.T) {
 		})
 	}
 }
+
+func TestLabelMappingFlag_UnmarshalYAML(t *testing.T) {
+	assert := assertpkg.New(t)
+
+	var flg LabelMappingFlag
+	require.NoError(t, yaml.Unmarshal([]byte(`server_group=group,severity`), &flg))
+	assert.Equal([]string{"server_group", "severity"}, flg.Labels)
+	assert.Equal([]string{"group", "severity"}, flg.Keys)
+
+	require.NoError(t, yaml.Unmarshal([]byte("[server_group=group, severity]"), &flg))
+	assert.Equal([]string{"server_group", "severity"}, flg.Labels)
+	assert.Equal([]string{"group", "severity"}, flg.Keys)
+
+	err := yaml.Unmarshal([]byte("[severity, severity]"), &flg)
+	assert.ErrorIs(err, ErrLabelDup)
+}
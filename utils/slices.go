@@ -14,6 +14,17 @@ func RemoveElements[S ~[]E, E comparable](slice S, drop S) S {
 	return res
 }
 
+// KeepElements returns a copy of slice with only the elements present in keep.
+func KeepElements[S ~[]E, E comparable](slice S, keep S) S {
+	res := make(S, 0, len(slice))
+	for _, s := range slice {
+		if slices.Contains(keep, s) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
 // UniqueElements returns slice items with duplicates removed, preserving order.
 func UniqueElements[S ~[]E, E comparable](slice S) S {
 	seen := map[E]struct{}{}
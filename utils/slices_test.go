@@ -11,6 +11,11 @@ func TestRemoveElements(t *testing.T) {
 	assert.Equal(t, []string{"a", "c"}, result)
 }
 
+func TestKeepElements(t *testing.T) {
+	result := KeepElements([]string{"a", "b", "c", "b"}, []string{"b", "c", "d"})
+	assert.Equal(t, []string{"b", "c", "b"}, result)
+}
+
 func TestUniqueElements(t *testing.T) {
 	result := UniqueElements([]string{"a", "b", "a", "c", "b"})
 	assert.Equal(t, []string{"a", "b", "c"}, result)